@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+const (
+	stageSingle = "single"
+	stageMulti  = "multi"
+)
+
+// SignerCheckpoint если задан - SingleHash и MultiHash берут из него уже посчитанные значения
+// и складывают туда новые. nil - чекпоинты выключены
+var SignerCheckpoint *Checkpoint
+
+type checkpointRecord struct {
+	Stage string `json:"stage"`
+	Salt  string `json:"salt"`
+	In    string `json:"in"`
+	Out   string `json:"out"`
+}
+
+type checkpointKey struct {
+	stage, salt, in string
+}
+
+// Checkpoint журнал посчитанных хешей: одна JSON-запись на строку, только дописывается в конец
+type Checkpoint struct {
+	mu   sync.Mutex
+	file *os.File
+	done map[checkpointKey]string
+}
+
+// OpenCheckpoint открывает (или создаёт) журнал и загружает из него готовые результаты.
+// Оборванная последняя запись (упали посреди записи) отрезается
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Checkpoint{file: file, done: make(map[checkpointKey]string)}
+	valid, err := c.load()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	if err = file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err = file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// load читает записи и возвращает длину корректной части файла
+func (c *Checkpoint) load() (int64, error) {
+	var valid int64
+	r := bufio.NewReader(c.file)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// хвост без перевода строки - запись не дописана
+			return valid, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		rec := checkpointRecord{}
+		if err = json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			if _, errPeek := r.Peek(1); errPeek == io.EOF {
+				return valid, nil
+			}
+			return 0, fmt.Errorf("line %d: %w", n, err)
+		}
+		c.done[checkpointKey{rec.Stage, rec.Salt, rec.In}] = rec.Out
+		valid += int64(len(line))
+	}
+}
+
+// Lookup ищет готовый результат этапа для входа in
+func (c *Checkpoint) Lookup(stage, in string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out, ok := c.done[checkpointKey{stage, DataSignerSalt, in}]
+	return out, ok
+}
+
+// Save дописывает результат в журнал и сбрасывает его на диск
+func (c *Checkpoint) Save(stage, in, out string) error {
+	if c == nil {
+		return nil
+	}
+	line, err := json.Marshal(checkpointRecord{Stage: stage, Salt: DataSignerSalt, In: in, Out: out})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err = c.file.Write(line); err != nil {
+		return err
+	}
+	if err = c.file.Sync(); err != nil {
+		return err
+	}
+	c.done[checkpointKey{stage, DataSignerSalt, in}] = out
+	return nil
+}
+
+// Len сколько результатов в журнале
+func (c *Checkpoint) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.done)
+}
+
+// Close ...
+func (c *Checkpoint) Close() error {
+	return c.file.Close()
+}
+
+// saveCheckpoint не валит конвейер, если журнал не записался - результат просто посчитается заново
+func saveCheckpoint(stage, in, out string) {
+	if err := SignerCheckpoint.Save(stage, in, out); err != nil {
+		log.Println("checkpoint save failed:", err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func withCheckpoint(t *testing.T, path string, f func(c *Checkpoint)) {
+	c, err := OpenCheckpoint(path)
+	if err != nil {
+		t.Fatalf("cant open checkpoint: %s", err)
+	}
+	SignerCheckpoint = c
+	defer func() {
+		SignerCheckpoint = nil
+		c.Close()
+	}()
+	f(c)
+}
+
+func TestCheckpointResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "signer.jsonl")
+
+	inputData := []int{0, 1, 1, 2, 3, 5, 8}
+
+	var firstResult string
+	withCheckpoint(t, path, func(c *Checkpoint) {
+		rep := Simulate(signerJobs(inputData, &firstResult)...)
+		if rep.Crc32Calls != len(inputData)*8 {
+			t.Errorf("first run must compute everything, crc32 calls %d", rep.Crc32Calls)
+		}
+	})
+	if firstResult != signerExpected {
+		t.Fatalf("results not match\nGot: %v\nExpected: %v", firstResult, signerExpected)
+	}
+
+	// как будто упали посреди записи
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"stage":"single","salt":"","in":"13","o`)
+	f.Close()
+
+	var secondResult string
+	withCheckpoint(t, path, func(c *Checkpoint) {
+		// 0 и 1 повторяются, поэтому уникальных входов 6 на каждый этап
+		if c.Len() != 12 {
+			t.Errorf("expected 12 records, got %d", c.Len())
+		}
+		rep := Simulate(signerJobs(inputData, &secondResult)...)
+		if rep.Crc32Calls != 0 || rep.Md5Calls != 0 {
+			t.Errorf("resumed run must not compute hashes: md5 %d, crc32 %d", rep.Md5Calls, rep.Crc32Calls)
+		}
+	})
+	if secondResult != firstResult {
+		t.Errorf("resumed result differs\nGot: %v\nExpected: %v", secondResult, firstResult)
+	}
+}
+
+func TestCheckpointSalt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	withCheckpoint(t, filepath.Join(dir, "signer.jsonl"), func(c *Checkpoint) {
+		if err := c.Save(stageSingle, "1", "hash"); err != nil {
+			t.Fatal(err)
+		}
+		DataSignerSalt = "salt"
+		defer func() { DataSignerSalt = "" }()
+		if _, ok := c.Lookup(stageSingle, "1"); ok {
+			t.Error("result with another salt must not be reused")
+		}
+	})
+}
+
+func TestCheckpointCorrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// битая запись не последняя - это не оборванный хвост, а испорченный журнал
+	path := filepath.Join(dir, "signer.jsonl")
+	if err := ioutil.WriteFile(path, []byte("{\"stage\":\"single\"}\n{oops\n{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = OpenCheckpoint(path)
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("expected json syntax error, got %v", err)
+	}
+
+	_, err = OpenCheckpoint(filepath.Join(dir, "missing", "signer.jsonl"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"container/heap"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Clock - источник времени для DataSigner* и OverheatLock.
+// Подменяется на FakeClock, чтобы гонять конвейер в виртуальном времени
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+var clock Clock = realClock{}
+
+type sleeper struct {
+	until time.Time
+	wake  chan struct{}
+}
+
+type sleepers []*sleeper
+
+func (s sleepers) Len() int            { return len(s) }
+func (s sleepers) Less(i, j int) bool  { return s[i].until.Before(s[j].until) }
+func (s sleepers) Swap(i, j int)       { s[i], s[j] = s[j], s[i] }
+func (s *sleepers) Push(x interface{}) { *s = append(*s, x.(*sleeper)) }
+func (s *sleepers) Pop() interface{} {
+	old := *s
+	x := old[len(old)-1]
+	*s = old[:len(old)-1]
+	return x
+}
+
+// FakeClock - виртуальные часы: Sleep не спит, а ждёт пока кто-то сдвинет время
+type FakeClock struct {
+	mu    sync.Mutex
+	start time.Time
+	now   time.Time
+	queue sleepers
+}
+
+// NewFakeClock ...
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{start: start, now: start}
+}
+
+// Now ...
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Elapsed сколько виртуального времени прошло с момента создания
+func (c *FakeClock) Elapsed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now.Sub(c.start)
+}
+
+// Sleep блокируется до тех пор, пока часы не сдвинут на d
+func (c *FakeClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		runtime.Gosched()
+		return
+	}
+	c.mu.Lock()
+	s := &sleeper{until: c.now.Add(d), wake: make(chan struct{})}
+	heap.Push(&c.queue, s)
+	c.mu.Unlock()
+	trackWork()
+	<-s.wake
+	trackWork()
+}
+
+// Sleepers сколько горутин сейчас спит
+func (c *FakeClock) Sleepers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.queue)
+}
+
+// Advance сдвигает время на d и будит всех, чей срок наступил
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advanceTo(c.now.Add(d))
+}
+
+// AdvanceToNext сдвигает время до ближайшего пробуждения.
+// Возвращает false, если никто не спит
+func (c *FakeClock) AdvanceToNext() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.queue) == 0 {
+		return false
+	}
+	c.advanceTo(c.queue[0].until)
+	return true
+}
+
+func (c *FakeClock) advanceTo(t time.Time) {
+	if t.After(c.now) {
+		c.now = t
+	}
+	for len(c.queue) > 0 && !c.queue[0].until.After(c.now) {
+		s := heap.Pop(&c.queue).(*sleeper)
+		close(s.wake)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DebugConfig настройки отладочного режима конвейера
+type DebugConfig struct {
+	// сколько ждать без единого движения данных, прежде чем проверять, не застрял ли конвейер.
+	// Застрявшим он считается, только если все его горутины стоят на каналах или мьютексах,
+	// иначе это просто долгий этап: дамп уходит в Report, а конвейер работает дальше
+	IdleTimeout time.Duration
+	// куда отдать дамп застрявших этапов, по умолчанию в os.Stderr
+	Report func(dump string)
+	// добавить в дамп стеки всех горутин
+	Stacks bool
+}
+
+// StageState состояние одного этапа на момент дампа
+type StageState struct {
+	Index    int
+	Received int  // сколько значений забрал из in
+	Sent     int  // сколько значений отдал в out
+	Done     bool // функция этапа вернулась
+	// сколько значение из out висит непринятым следующим этапом.
+	// Посредник держит одно значение, поэтому сам этап мог уже и завершиться
+	BlockedSend time.Duration
+	// этап ждёт данных из in, а предыдущий этап ещё работает
+	BlockedRecv bool
+	// этап так и не завершился после того, как конвейер разблокировали
+	Leaked bool
+}
+
+func (s StageState) String() string {
+	state := "running"
+	if s.Done {
+		state = "done"
+	}
+	res := fmt.Sprintf("stage %d: %s, in %d, out %d", s.Index, state, s.Received, s.Sent)
+	if s.BlockedSend > 0 {
+		res += fmt.Sprintf(", blocked sending to stage %d for %s", s.Index+1, s.BlockedSend)
+	}
+	if s.BlockedRecv {
+		res += fmt.Sprintf(", waiting for input from stage %d", s.Index-1)
+	}
+	if s.Leaked {
+		res += ", leaked"
+	}
+	return res
+}
+
+// StuckError конвейер перестал двигаться дольше IdleTimeout
+type StuckError struct {
+	Idle   time.Duration
+	Stages []StageState
+}
+
+func (e *StuckError) Error() string {
+	return formatStages(fmt.Sprintf("pipeline stuck for %s", e.Idle), e.Stages)
+}
+
+func formatStages(header string, stages []StageState) string {
+	lines := make([]string, 0, len(stages)+1)
+	lines = append(lines, header)
+	for _, s := range stages {
+		lines = append(lines, "  "+s.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// связь между out этапа i и in этапа i+1
+type debugLink struct {
+	passed  int
+	pending bool
+	since   time.Time
+	closed  bool
+}
+
+type debugPipeline struct {
+	cfg DebugConfig
+
+	mu       sync.Mutex
+	links    []debugLink
+	done     []bool
+	progress time.Time
+
+	drain chan struct{}
+}
+
+// ExecutePipelineDebug то же, что ExecutePipeline, только каналы между этапами идут через
+// посредников, которые считают движение данных (и добавляют буфер на одно значение). Если за IdleTimeout ничего не сдвинулось
+// и все горутины конвейера встали, отдаёт дамп застрявших этапов в Report, выбрасывает висящие значения, закрывает входы
+// и возвращает *StuckError
+func ExecutePipelineDebug(cfg DebugConfig, jobs ...job) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = time.Second
+	}
+	if cfg.Report == nil {
+		cfg.Report = func(dump string) {
+			fmt.Fprintln(os.Stderr, dump)
+		}
+	}
+
+	p := &debugPipeline{
+		cfg:      cfg,
+		links:    make([]debugLink, len(jobs)),
+		done:     make([]bool, len(jobs)),
+		progress: time.Now(),
+		drain:    make(chan struct{}),
+	}
+
+	// этапы запускает отдельная горутина, чтобы по её потомкам отличать горутины конвейера от чужих
+	first := make(chan interface{})
+	finished := make(chan struct{})
+	root := make(chan uint64, 1)
+	go func() {
+		root <- goroutineID()
+		var wg sync.WaitGroup
+		in := first
+		for i, j := range jobs {
+			out := make(chan interface{})
+			var next chan interface{}
+			if i < len(jobs)-1 {
+				next = make(chan interface{})
+			}
+			wg.Add(2)
+			go p.runStage(&wg, i, j, in, out)
+			go p.forward(&wg, i, out, next)
+			in = next
+		}
+		wg.Wait()
+		close(finished)
+	}()
+
+	pipeline := &goroutineTree{root: <-root, members: map[uint64]bool{}, parked: stuckState}
+	err := p.watch(finished, pipeline)
+	if err == nil {
+		close(first)
+		return nil
+	}
+
+	// разблокируем всё, что можем, и смотрим, кто так и не завершился
+	close(p.drain)
+	close(first)
+	select {
+	case <-finished:
+	case <-time.After(cfg.IdleTimeout):
+	}
+	p.mu.Lock()
+	for i := range err.Stages {
+		err.Stages[i].Leaked = !p.done[i]
+	}
+	p.mu.Unlock()
+
+	dump := err.Error()
+	if cfg.Stacks {
+		buf := make([]byte, 1<<20)
+		dump += "\n\n" + string(buf[:runtime.Stack(buf, true)])
+	}
+	cfg.Report(dump)
+	return err
+}
+
+func (p *debugPipeline) runStage(wg *sync.WaitGroup, i int, j job, in, out chan interface{}) {
+	defer wg.Done()
+	j(in, out)
+	close(out)
+	p.mu.Lock()
+	p.done[i] = true
+	p.progress = time.Now()
+	p.mu.Unlock()
+}
+
+// forward перекладывает значения из out этапа i в in этапа i+1
+func (p *debugPipeline) forward(wg *sync.WaitGroup, i int, up <-chan interface{}, down chan interface{}) {
+	defer wg.Done()
+	l := &p.links[i]
+	downClosed := false
+	closeDown := func() {
+		if !downClosed && down != nil {
+			close(down)
+		}
+		downClosed = true
+	}
+	defer closeDown()
+
+	for v := range up {
+		p.mu.Lock()
+		l.pending, l.since = true, time.Now()
+		p.progress = l.since
+		p.mu.Unlock()
+
+		if !downClosed {
+			select {
+			case down <- v:
+			case <-p.drain:
+				closeDown()
+			}
+		}
+
+		p.mu.Lock()
+		l.pending = false
+		l.passed++
+		p.progress = time.Now()
+		p.mu.Unlock()
+	}
+
+	p.mu.Lock()
+	l.closed = true
+	p.mu.Unlock()
+}
+
+// watch ждёт завершения конвейера. Застрявшим он считается, если данные не двигались IdleTimeout
+// и ни одна его горутина не работает; пока кто-то работает, о простое только сообщается, раз за простой
+func (p *debugPipeline) watch(finished <-chan struct{}, pipeline *goroutineTree) *StuckError {
+	ticker := time.NewTicker(p.cfg.IdleTimeout / 4)
+	defer ticker.Stop()
+	var reported time.Time
+	for {
+		select {
+		case <-finished:
+			return nil
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		progress := p.progress
+		p.mu.Unlock()
+		idle := time.Since(progress)
+		if idle < p.cfg.IdleTimeout {
+			continue
+		}
+		if pipeline.idle() {
+			select {
+			case <-finished:
+				return nil
+			default:
+				return &StuckError{Idle: idle, Stages: p.snapshot()}
+			}
+		}
+		if !reported.Equal(progress) {
+			reported = progress
+			p.cfg.Report(formatStages(fmt.Sprintf("pipeline idle for %s, stages still working", idle), p.snapshot()))
+		}
+	}
+}
+
+// stuckState горутина ждёт другую горутину конвейера. В отличие от симуляции,
+// ожидание сети (удалённый этап ждёт воркер) - это работа, а не остановка
+func stuckState(state string) bool {
+	return parkedState(state) && !strings.HasPrefix(state, "IO wait")
+}
+
+func (p *debugPipeline) snapshot() []StageState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	stages := make([]StageState, len(p.done))
+	for i := range stages {
+		s := StageState{Index: i, Sent: p.links[i].passed, Done: p.done[i]}
+		if p.links[i].pending {
+			s.Sent++
+			s.BlockedSend = now.Sub(p.links[i].since)
+		}
+		if i > 0 {
+			prev := p.links[i-1]
+			s.Received = prev.passed
+			s.BlockedRecv = !s.Done && !prev.pending && !prev.closed && !p.done[i-1]
+		}
+		stages[i] = s
+	}
+	return stages
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipelineDebugOk(t *testing.T) {
+	var sum int
+	err := ExecutePipelineDebug(DebugConfig{IdleTimeout: 100 * time.Millisecond},
+		job(func(in, out chan interface{}) {
+			for i := 1; i <= 3; i++ {
+				out <- i
+			}
+		}),
+		job(func(in, out chan interface{}) {
+			for v := range in {
+				sum += v.(int)
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if sum != 6 {
+		t.Errorf("values lost, sum = %d", sum)
+	}
+}
+
+func TestPipelineDebugEarlyReturn(t *testing.T) {
+	var dump string
+	err := ExecutePipelineDebug(DebugConfig{
+		IdleTimeout: 100 * time.Millisecond,
+		Report:      func(d string) { dump = d },
+	},
+		job(func(in, out chan interface{}) {
+			for i := 0; i < 3; i++ {
+				out <- i
+			}
+		}),
+		job(func(in, out chan interface{}) {
+			<-in
+		}),
+	)
+
+	stuck := &StuckError{}
+	if !errors.As(err, &stuck) {
+		t.Fatalf("expected *StuckError, got %v", err)
+	}
+	if len(stuck.Stages) != 2 {
+		t.Fatalf("expected 2 stages, got %d", len(stuck.Stages))
+	}
+	if s := stuck.Stages[0]; s.Done || s.BlockedSend == 0 || s.Leaked {
+		t.Errorf("stage 0 must be blocked on send and released after drain: %s", s)
+	}
+	if s := stuck.Stages[1]; !s.Done || s.Received != 1 {
+		t.Errorf("stage 1 must be done after 1 value: %s", s)
+	}
+	if !strings.Contains(dump, "blocked sending to stage 1") {
+		t.Errorf("dump has no blocked sender:\n%s", dump)
+	}
+}
+
+func TestPipelineDebugNoReader(t *testing.T) {
+	err := ExecutePipelineDebug(DebugConfig{
+		IdleTimeout: 100 * time.Millisecond,
+		Report:      func(string) {},
+	},
+		job(func(in, out chan interface{}) {
+			out <- "1"
+			out <- "2"
+		}),
+		job(CombineResults),
+		job(func(in, out chan interface{}) {}),
+	)
+
+	stuck := &StuckError{}
+	if !errors.As(err, &stuck) {
+		t.Fatalf("expected *StuckError, got %v", err)
+	}
+	if s := stuck.Stages[1]; s.Sent != 1 || s.BlockedSend == 0 {
+		t.Errorf("CombineResults result must be unread: %s", s)
+	}
+	for _, s := range stuck.Stages {
+		if s.Leaked {
+			t.Errorf("stage is not released: %s", s)
+		}
+	}
+}
+
+func TestPipelineDebugSigner(t *testing.T) {
+	if testing.Short() {
+		t.Skip("real hash delays are skipped in short mode")
+	}
+	// crc32 считается секунду, за которую по каналам ничего не проходит: это не застревание
+	inputData := []int{0, 1, 1, 2, 3, 5, 8}
+	result := "NOT_SET"
+	if err := ExecutePipelineDebug(DebugConfig{}, signerJobs(inputData, &result)...); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result != signerExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, signerExpected)
+	}
+}
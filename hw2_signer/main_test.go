@@ -60,6 +60,12 @@ func TestSigner(t *testing.T) {
 		DataSignerMd5Counter   uint32
 		DataSignerCrc32Counter uint32
 	)
+	origOverheatLock, origOverheatUnlock := OverheatLock, OverheatUnlock
+	origMd5, origCrc32 := DataSignerMd5, DataSignerCrc32
+	defer func() {
+		OverheatLock, OverheatUnlock = origOverheatLock, origOverheatUnlock
+		DataSignerMd5, DataSignerCrc32 = origMd5, origCrc32
+	}()
 	OverheatLock = func() {
 		atomic.AddUint32(&OverheatLockCounter, 1)
 		for {
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// RemoteWindow сколько элементов может одновременно висеть на одном воркере
+var RemoteWindow = 4
+
+// этапы, которые умеет считать воркер
+var remoteStages = map[string]func(it Item, data string) (string, error){
+	stageSingle: singleHash,
+	stageMulti:  multiHash,
+}
+
+// сообщения ходят в JSON, чтобы не тащить protoc ради двух структур
+const jsonCodecName = "json"
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return jsonCodecName }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type stageRequest struct {
+	Stage    string
+	Seq      uint64
+	Data     string
+	Priority int
+	Deadline time.Time
+}
+
+type stageResponse struct {
+	Seq    uint64
+	Result string
+	Error  string
+}
+
+var stageServiceDesc = grpc.ServiceDesc{
+	ServiceName: "signer.Stage",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Process",
+			Handler:       processStage,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+const processMethod = "/signer.Stage/Process"
+
+// ServeStageWorker поднимает воркер на lis. Остановить - через Stop у возвращённого сервера
+func ServeStageWorker(lis net.Listener) *grpc.Server {
+	server := grpc.NewServer()
+	server.RegisterService(&stageServiceDesc, struct{}{})
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			log.Println("stage worker stopped:", err)
+		}
+	}()
+	return server
+}
+
+// processStage каждый элемент из стрима считается в своей горутине, ответы уходят по мере готовности
+func processStage(srv interface{}, stream grpc.ServerStream) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	var sendMu sync.Mutex
+
+	for {
+		req := &stageRequest{}
+		if err := stream.RecvMsg(req); err != nil {
+			// EOF - координатор закрыл отправку, досчитываем то что есть
+			return nil
+		}
+
+		wg.Add(1)
+		go func(req *stageRequest) {
+			defer wg.Done()
+			resp := &stageResponse{Seq: req.Seq}
+			hash, ok := remoteStages[req.Stage]
+			if !ok {
+				resp.Error = fmt.Sprintf("unknown stage %q", req.Stage)
+			} else {
+				it := Item{Data: req.Data, Priority: req.Priority, Deadline: req.Deadline}
+				result, err := hash(it, req.Data)
+				if err != nil {
+					resp.Error = err.Error()
+				}
+				resp.Result = result
+			}
+
+			sendMu.Lock()
+			defer sendMu.Unlock()
+			if err := stream.SendMsg(resp); err != nil {
+				log.Println("cant send stage result:", err)
+			}
+		}(req)
+	}
+}
+
+type remoteTask struct {
+	seq     uint64
+	it      Item
+	wrapped bool
+	data    string
+}
+
+// remoteStage координатор: раздаёт элементы воркерам и собирает ответы
+type remoteStage struct {
+	stage string
+	out   chan interface{}
+	tasks chan *remoteTask
+	wg    sync.WaitGroup // элементы, по которым ещё нет ответа
+
+	mu    sync.Mutex
+	alive int
+}
+
+// RemoteStage возвращает этап конвейера, который считает stage ("single" или "multi") на воркерах addrs.
+// Элементы упавшего воркера уходят остальным, если живых не осталось - считаются локально
+func RemoteStage(stage string, addrs ...string) job {
+	return func(in, out chan interface{}) {
+		hash, ok := remoteStages[stage]
+		if !ok {
+			panic(fmt.Sprintf("unknown stage %q", stage))
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		r := &remoteStage{stage: stage, out: out, tasks: make(chan *remoteTask)}
+		streams := make(map[string]grpc.ClientStream, len(addrs))
+		for _, addr := range addrs {
+			conn, err := grpc.Dial(addr, grpc.WithInsecure())
+			if err != nil {
+				log.Printf("cant dial worker %s: %s", addr, err)
+				continue
+			}
+			defer conn.Close()
+			stream, err := conn.NewStream(ctx, &stageServiceDesc.Streams[0], processMethod,
+				grpc.CallContentSubtype(jsonCodecName))
+			if err != nil {
+				log.Printf("cant open stream to worker %s: %s", addr, err)
+				continue
+			}
+			streams[addr] = stream
+		}
+		if len(streams) == 0 {
+			log.Printf("no workers for stage %s, computing locally", stage)
+			hashStage(in, out, hash)
+			return
+		}
+		r.alive = len(streams)
+		for addr, stream := range streams {
+			go r.run(addr, stream)
+		}
+
+		var seq uint64
+		for step := range in {
+			if dropped, ok := step.(*ItemError); ok {
+				out <- dropped
+				continue
+			}
+			it, wrapped := asItem(step)
+			t := &remoteTask{seq: seq, it: it, wrapped: wrapped, data: fmt.Sprintf("%v", it.Data)}
+			seq++
+			if result, ok := SignerCheckpoint.Lookup(stage, t.data); ok {
+				r.deliver(t, result, nil)
+				continue
+			}
+			r.wg.Add(1)
+			r.tasks <- t
+		}
+		r.wg.Wait()
+		close(r.tasks)
+	}
+}
+
+// run гоняет один стрим: отправляет не больше RemoteWindow элементов без ответа
+func (r *remoteStage) run(addr string, stream grpc.ClientStream) {
+	credits := make(chan struct{}, RemoteWindow)
+	var mu sync.Mutex
+	pending := make(map[uint64]*remoteTask)
+	// done закрывается, когда воркер упал: отправителю больше нечего ждать
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case credits <- struct{}{}:
+			case <-done:
+				return
+			}
+			var t *remoteTask
+			var ok bool
+			select {
+			case t, ok = <-r.tasks:
+			case <-done:
+				return
+			}
+			if !ok {
+				stream.CloseSend()
+				return
+			}
+			mu.Lock()
+			if pending == nil {
+				// воркер уже упал, элемент достанется другим
+				mu.Unlock()
+				go func() {
+					r.tasks <- t
+				}()
+				return
+			}
+			pending[t.seq] = t
+			mu.Unlock()
+			req := &stageRequest{Stage: r.stage, Seq: t.seq, Data: t.data, Priority: t.it.Priority, Deadline: t.it.Deadline}
+			if err := stream.SendMsg(req); err != nil {
+				// ошибку увидит получатель ниже и раздаст pending остальным
+				return
+			}
+		}
+	}()
+
+	for {
+		resp := &stageResponse{}
+		if err := stream.RecvMsg(resp); err != nil {
+			close(done)
+			mu.Lock()
+			lost := pending
+			pending = nil
+			mu.Unlock()
+			if len(lost) > 0 {
+				log.Printf("worker %s failed with %d items in flight: %s", addr, len(lost), err)
+			}
+			r.failover(lost)
+			return
+		}
+
+		mu.Lock()
+		t := pending[resp.Seq]
+		delete(pending, resp.Seq)
+		mu.Unlock()
+		if t == nil {
+			continue
+		}
+		<-credits
+
+		var err error
+		if resp.Error != "" {
+			err = errors.New(resp.Error)
+			if resp.Error == ErrDeadlineExceeded.Error() {
+				err = ErrDeadlineExceeded
+			}
+		} else {
+			saveCheckpoint(r.stage, t.data, resp.Result)
+		}
+		r.deliver(t, resp.Result, err)
+		r.wg.Done()
+	}
+}
+
+// failover отдаёт недосчитанные элементы остальным воркерам, а если их нет - считает сам
+func (r *remoteStage) failover(lost map[uint64]*remoteTask) {
+	r.mu.Lock()
+	r.alive--
+	last := r.alive == 0
+	r.mu.Unlock()
+
+	for _, t := range lost {
+		go func(t *remoteTask) {
+			r.tasks <- t
+		}(t)
+	}
+	if !last {
+		return
+	}
+
+	hash := remoteStages[r.stage]
+	for t := range r.tasks {
+		go func(t *remoteTask) {
+			result, err := hash(t.it, t.data)
+			r.deliver(t, result, err)
+			r.wg.Done()
+		}(t)
+	}
+}
+
+func (r *remoteStage) deliver(t *remoteTask, result string, err error) {
+	switch {
+	case err != nil:
+		r.out <- &ItemError{Item: t.it, Err: err}
+	case !t.wrapped:
+		r.out <- result
+	default:
+		it := t.it
+		it.Data = result
+		r.out <- it
+	}
+}
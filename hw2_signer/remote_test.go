@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// instantClock считает хеши без задержек, сетевому тесту виртуальное время ни к чему
+type instantClock struct {
+	realClock
+}
+
+func (instantClock) Sleep(time.Duration) {}
+
+func startWorkers(t *testing.T, n int) ([]string, func()) {
+	addrs := []string{}
+	stops := []func(){}
+	for i := 0; i < n; i++ {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("cant listen port: %s", err)
+		}
+		addrs = append(addrs, lis.Addr().String())
+		stops = append(stops, ServeStageWorker(lis).Stop)
+	}
+	return addrs, func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+// deadAddr адрес, на котором никто не слушает
+func deadAddr(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cant listen port: %s", err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	return addr
+}
+
+func runRemote(t *testing.T, single, multi job) {
+	clock = instantClock{}
+	defer func() { clock = realClock{} }()
+
+	inputData := []int{0, 1, 1, 2, 3, 5, 8}
+	result := "NOT_SET"
+	jobs := signerJobs(inputData, &result)
+	jobs[1], jobs[2] = single, multi
+	ExecutePipeline(jobs...)
+
+	if result != signerExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, signerExpected)
+	}
+}
+
+func TestRemoteStage(t *testing.T) {
+	addrs, stop := startWorkers(t, 3)
+	defer stop()
+
+	RemoteWindow = 1
+	defer func() { RemoteWindow = 4 }()
+	runRemote(t, RemoteStage(stageSingle, addrs...), RemoteStage(stageMulti, addrs...))
+}
+
+func TestRemoteStageFailover(t *testing.T) {
+	addrs, stop := startWorkers(t, 1)
+	defer stop()
+
+	runRemote(t, job(SingleHash), RemoteStage(stageMulti, deadAddr(t), addrs[0]))
+}
+
+func TestRemoteStageNoWorkers(t *testing.T) {
+	runRemote(t, job(SingleHash), RemoteStage(stageMulti, deadAddr(t)))
+}
+
+// gateClock держит все Sleep, пока не откроют gate
+type gateClock struct {
+	realClock
+	sleepers chan struct{}
+	gate     chan struct{}
+}
+
+func (c gateClock) Sleep(time.Duration) {
+	c.sleepers <- struct{}{}
+	<-c.gate
+}
+
+func TestRemoteStageWorkerDies(t *testing.T) {
+	inputData := []string{"a", "b", "c"}
+	jobs := func(multi job, result *string) []job {
+		return []job{
+			job(func(in, out chan interface{}) {
+				for _, data := range inputData {
+					out <- data
+				}
+			}),
+			multi,
+			job(CombineResults),
+			job(func(in, out chan interface{}) {
+				*result, _ = (<-in).(string)
+			}),
+		}
+	}
+
+	clock = instantClock{}
+	defer func() { clock = realClock{} }()
+	var expected string
+	ExecutePipeline(jobs(job(MultiHash), &expected)...)
+
+	addrs, stop := startWorkers(t, 1)
+	defer stop()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cant listen port: %s", err)
+	}
+	dying := ServeStageWorker(lis)
+
+	gc := gateClock{sleepers: make(chan struct{}, 100), gate: make(chan struct{})}
+	clock = gc
+	RemoteWindow = 1
+	defer func() { RemoteWindow = 4 }()
+
+	var result string
+	done := make(chan struct{})
+	go func() {
+		ExecutePipeline(jobs(RemoteStage(stageMulti, addrs[0], lis.Addr().String()), &result)...)
+		close(done)
+	}()
+
+	// оба воркера взяли по элементу и считают 6 crc32
+	for i := 0; i < 12; i++ {
+		<-gc.sleepers
+	}
+	dying.Stop()
+	close(gc.gate)
+	<-done
+
+	if result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+	// отправитель упавшего воркера ждал места в окне и не должен остаться висеть
+	if n := remoteGoroutines(time.Second); n != 0 {
+		t.Errorf("%d remote stage goroutines left after pipeline finished", n)
+	}
+}
+
+// remoteGoroutines сколько горутин координатора ещё живо, ждёт их завершения не дольше timeout
+func remoteGoroutines(timeout time.Duration) int {
+	buf := make([]byte, 1<<20)
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		stacks := buf[:runtime.Stack(buf, true)]
+		n := 0
+		for _, stack := range bytes.Split(stacks, []byte("\n\n")) {
+			if bytes.Contains(stack, []byte(".(*remoteStage).")) {
+				n++
+			}
+		}
+		if n == 0 || time.Since(start) > timeout {
+			return n
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrDeadlineExceeded элемент не успели обработать до его срока
+var ErrDeadlineExceeded = errors.New("item deadline exceeded")
+
+// Item элемент конвейера с приоритетом и необязательным сроком.
+// SingleHash и MultiHash принимают как Item, так и голые значения
+type Item struct {
+	Data     interface{}
+	Priority int       // больше - важнее, в SchedWeightedFair отрицательные весят как 0
+	Deadline time.Time // нулевой - без срока
+}
+
+func (it Item) expired() bool {
+	return !it.Deadline.IsZero() && !clock.Now().Before(it.Deadline)
+}
+
+func asItem(v interface{}) (Item, bool) {
+	if it, ok := v.(Item); ok {
+		return it, true
+	}
+	return Item{Data: v}, false
+}
+
+// ItemError элемент выброшен из конвейера, дальше по конвейеру идёт вместо результата
+type ItemError struct {
+	Item Item
+	Err  error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("item %v dropped: %s", e.Item.Data, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// SchedMode порядок, в котором элементы получают md5 и crc32
+type SchedMode int
+
+const (
+	// SchedPriority строго по приоритету, при равном - у кого срок ближе, потом кто раньше пришёл
+	SchedPriority SchedMode = iota
+	// SchedWeightedFair доля каждого приоритета пропорциональна Priority+1, низкие не голодают
+	SchedWeightedFair
+)
+
+// SchedConfig ...
+type SchedConfig struct {
+	Mode SchedMode
+	// элементы, до срока которых осталось меньше, идут вне очереди
+	UrgentWindow time.Duration
+	// сколько DataSignerCrc32 может считаться одновременно, 0 - без ограничений
+	MaxCrc32 int
+}
+
+// Scheduling настройки очередности в SingleHash и MultiHash, менять до запуска конвейера
+var Scheduling = SchedConfig{}
+
+var (
+	md5Sched   = &scheduler{limit: func() int { return 1 }}
+	crc32Sched = &scheduler{limit: func() int { return Scheduling.MaxCrc32 }}
+)
+
+type waiter struct {
+	it    Item
+	seq   uint64
+	ready chan error
+}
+
+// scheduler раздаёт limit мест между элементами в порядке Scheduling.Mode
+type scheduler struct {
+	limit func() int // <= 0 - без ограничений
+
+	mu    sync.Mutex
+	busy  int
+	seq   uint64
+	queue []*waiter
+	pass  map[int]float64 // виртуальное время каждого приоритета для SchedWeightedFair
+	vtime float64
+}
+
+// Acquire ждёт своей очереди. Если срок элемента прошёл - ErrDeadlineExceeded
+func (s *scheduler) Acquire(it Item) error {
+	if it.expired() {
+		return ErrDeadlineExceeded
+	}
+
+	s.mu.Lock()
+	limit := s.limit()
+	if limit <= 0 || (s.busy < limit && len(s.queue) == 0) {
+		s.busy++
+		s.charge(it)
+		s.mu.Unlock()
+		return nil
+	}
+	w := &waiter{it: it, seq: s.seq, ready: make(chan error, 1)}
+	s.seq++
+	s.queue = append(s.queue, w)
+	s.mu.Unlock()
+
+	return <-w.ready
+}
+
+// Release освобождает место и отдаёт его следующему
+func (s *scheduler) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.busy--
+
+	// просроченных выкидываем сразу, не дожидаясь их очереди
+	alive := s.queue[:0]
+	for _, w := range s.queue {
+		if w.it.expired() {
+			w.ready <- ErrDeadlineExceeded
+			continue
+		}
+		alive = append(alive, w)
+	}
+	s.queue = alive
+
+	limit := s.limit()
+	for len(s.queue) > 0 && (limit <= 0 || s.busy < limit) {
+		w := s.pop()
+		s.busy++
+		s.charge(w.it)
+		w.ready <- nil
+	}
+}
+
+func (s *scheduler) waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+func (s *scheduler) pop() *waiter {
+	now := clock.Now()
+	best := 0
+	for i := 1; i < len(s.queue); i++ {
+		if s.before(s.queue[i], s.queue[best], now) {
+			best = i
+		}
+	}
+	w := s.queue[best]
+	s.queue = append(s.queue[:best], s.queue[best+1:]...)
+	return w
+}
+
+func (s *scheduler) before(a, b *waiter, now time.Time) bool {
+	if ua, ub := urgent(a.it, now), urgent(b.it, now); ua != ub {
+		return ua
+	} else if ua {
+		return a.it.Deadline.Before(b.it.Deadline)
+	}
+	if Scheduling.Mode == SchedWeightedFair {
+		if pa, pb := s.classPass(a.it.Priority), s.classPass(b.it.Priority); pa != pb {
+			return pa < pb
+		}
+	}
+	if a.it.Priority != b.it.Priority {
+		return a.it.Priority > b.it.Priority
+	}
+	if da, db := a.it.Deadline, b.it.Deadline; !da.Equal(db) {
+		return !da.IsZero() && (db.IsZero() || da.Before(db))
+	}
+	return a.seq < b.seq
+}
+
+func urgent(it Item, now time.Time) bool {
+	return Scheduling.UrgentWindow > 0 && !it.Deadline.IsZero() && it.Deadline.Sub(now) < Scheduling.UrgentWindow
+}
+
+// classPass виртуальное время приоритета: вернувшийся после простоя не получает накопленный запас
+func (s *scheduler) classPass(priority int) float64 {
+	if p := s.pass[priority]; p > s.vtime {
+		return p
+	}
+	return s.vtime
+}
+
+// charge сдвигает виртуальное время приоритета на 1/вес.
+// вес Priority+1, но не меньше 1: отрицательный приоритет весит столько же, сколько нулевой
+func (s *scheduler) charge(it Item) {
+	if s.pass == nil {
+		s.pass = make(map[int]float64)
+	}
+	weight := it.Priority + 1
+	if weight < 1 {
+		weight = 1
+	}
+	p := s.classPass(it.Priority)
+	s.pass[it.Priority] = p + 1/float64(weight)
+	s.vtime = p
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// grantOrder ставит элементы в очередь занятого планировщика по одному и возвращает порядок,
+// в котором они получили место. beforeRelease вызывается, когда все уже в очереди
+func grantOrder(t *testing.T, s *scheduler, items []Item, beforeRelease func()) []string {
+	if err := s.Acquire(Item{Priority: -1}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for i, it := range items {
+		wg.Add(1)
+		go func(it Item) {
+			defer wg.Done()
+			err := s.Acquire(it)
+			mu.Lock()
+			if err != nil {
+				order = append(order, "!"+it.Data.(string))
+			} else {
+				order = append(order, it.Data.(string))
+			}
+			mu.Unlock()
+			if err == nil {
+				s.Release()
+			}
+		}(it)
+		for s.waiting() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if beforeRelease != nil {
+		beforeRelease()
+	}
+	s.Release()
+	wg.Wait()
+	return order
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	s := &scheduler{limit: func() int { return 1 }}
+	order := grantOrder(t, s, []Item{
+		{Data: "low"},
+		{Data: "high", Priority: 5},
+		{Data: "mid-late", Priority: 1, Deadline: time.Now().Add(time.Hour)},
+		{Data: "mid-soon", Priority: 1, Deadline: time.Now().Add(time.Minute)},
+	}, nil)
+	if got := strings.Join(order, " "); got != "high mid-soon mid-late low" {
+		t.Errorf("wrong order: %s", got)
+	}
+}
+
+func TestSchedulerDeadline(t *testing.T) {
+	s := &scheduler{limit: func() int { return 1 }}
+	if err := s.Acquire(Item{Deadline: time.Now().Add(-time.Second)}); !errors.Is(err, ErrDeadlineExceeded) {
+		t.Errorf("expired item must be rejected, got %v", err)
+	}
+
+	fc := NewFakeClock(time.Now())
+	clock = fc
+	Scheduling.UrgentWindow = time.Minute
+	defer func() {
+		clock = realClock{}
+		Scheduling = SchedConfig{}
+	}()
+	order := grantOrder(t, s, []Item{
+		{Data: "high", Priority: 5},
+		{Data: "urgent", Deadline: fc.Now().Add(time.Second)},
+		{Data: "expiring", Deadline: fc.Now().Add(10 * time.Millisecond)},
+	}, func() {
+		fc.Advance(20 * time.Millisecond)
+	})
+	// выкинутый просыпается вперемешку с остальными, поэтому проверяем его отдельно
+	granted := []string{}
+	rejected := []string{}
+	for _, name := range order {
+		if strings.HasPrefix(name, "!") {
+			rejected = append(rejected, name)
+		} else {
+			granted = append(granted, name)
+		}
+	}
+	if got := strings.Join(granted, " "); got != "urgent high" {
+		t.Errorf("wrong order: %s", got)
+	}
+	if got := strings.Join(rejected, " "); got != "!expiring" {
+		t.Errorf("expired item is not rejected: %s", got)
+	}
+}
+
+func TestSchedulerWeightedFair(t *testing.T) {
+	items := []Item{}
+	for i := 0; i < 3; i++ {
+		items = append(items, Item{Data: "L"})
+	}
+	for i := 0; i < 6; i++ {
+		items = append(items, Item{Data: "H", Priority: 1})
+	}
+
+	order := grantOrder(t, &scheduler{limit: func() int { return 1 }}, items, nil)
+	if got := strings.Join(order, ""); got != "HHHHHHLLL" {
+		t.Errorf("priority mode must serve high first: %s", got)
+	}
+
+	Scheduling.Mode = SchedWeightedFair
+	defer func() { Scheduling = SchedConfig{} }()
+	order = grantOrder(t, &scheduler{limit: func() int { return 1 }}, items, nil)
+	// вес высокого приоритета 2, низкого 1
+	if got := strings.Join(order, ""); got != "HLHHLHHLH" {
+		t.Errorf("low priority starves: %s", got)
+	}
+}
+
+func TestPipelineItems(t *testing.T) {
+	inputData := []int{0, 1, 1, 2, 3, 5, 8}
+	result := "NOT_SET"
+	var dropped []*ItemError
+
+	rep := Simulate(
+		job(func(in, out chan interface{}) {
+			for i, fibNum := range inputData {
+				out <- Item{Data: fibNum, Priority: i % 3}
+			}
+			out <- Item{Data: 13, Deadline: clock.Now()}
+		}),
+		job(SingleHash),
+		job(MultiHash),
+		job(func(in, out chan interface{}) {
+			for v := range in {
+				if err, ok := v.(*ItemError); ok {
+					dropped = append(dropped, err)
+					continue
+				}
+				out <- v
+			}
+		}),
+		job(CombineResults),
+		job(func(in, out chan interface{}) {
+			result, _ = (<-in).(string)
+		}),
+	)
+
+	if result != signerExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, signerExpected)
+	}
+	if rep.Elapsed > 3*time.Second {
+		t.Errorf("critical path too long: %s", rep.Elapsed)
+	}
+	if len(dropped) != 1 || !errors.Is(dropped[0], ErrDeadlineExceeded) || dropped[0].Item.Data != 13 {
+		t.Errorf("expired item must be dropped with error, got %v", dropped)
+	}
+}
+
+func TestCombineResultsReportsDropped(t *testing.T) {
+	logs := new(bytes.Buffer)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	result := "NOT_SET"
+	Simulate(
+		job(func(in, out chan interface{}) {
+			out <- Item{Data: 0}
+			out <- Item{Data: 13, Deadline: clock.Now()}
+		}),
+		job(SingleHash),
+		job(MultiHash),
+		job(CombineResults),
+		job(func(in, out chan interface{}) {
+			result, _ = (<-in).(string)
+		}),
+	)
+
+	if result != "29568666068035183841425683795340791879727309630931025356555" {
+		t.Errorf("dropped item must not get into result, got %v", result)
+	}
+	if !strings.Contains(logs.String(), "item 13 dropped: "+ErrDeadlineExceeded.Error()) {
+		t.Errorf("dropped item must be reported, log:\n%s", logs)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"sort"
 	"strconv"
 	"strings"
@@ -10,8 +11,6 @@ import (
 
 // сюда писать код
 
-var mux sync.Mutex
-
 // ExecutePipeline ...
 func ExecutePipeline(jobs ...job) {
 	if len(jobs) == 0 {
@@ -37,78 +36,136 @@ func runWorker(wg *sync.WaitGroup, j job, in, out chan interface{}) {
 
 // SingleHash ...
 func SingleHash(in, out chan interface{}) {
-	var wgr sync.WaitGroup
-	for step0 := range in {
-		wgr.Add(1)
-		go func(step0 interface{}) {
-			data := fmt.Sprintf("%v", step0)
-
-			mux.Lock()
-			md5 := DataSignerMd5(data) // 0.1 sec
-			mux.Unlock()
-
-			var hash1 string
-			var hash2 string
+	hashStage(in, out, singleHash)
+}
 
-			var wg sync.WaitGroup
-			wg.Add(1)
-			go Crc32(&wg, &hash1, data)
-			wg.Add(1)
-			go Crc32(&wg, &hash2, md5)
-			wg.Wait() // 1 sec
+func singleHash(it Item, data string) (string, error) {
+	if result, ok := SignerCheckpoint.Lookup(stageSingle, data); ok {
+		return result, nil
+	}
 
-			result := hash1 + "~" + hash2
+	if err := md5Sched.Acquire(it); err != nil {
+		return "", err
+	}
+	md5 := DataSignerMd5(data) // 0.1 sec
+	md5Sched.Release()
 
-			out <- result
-			wgr.Done()
-		}(step0)
+	hashes, err := crc32All(it, data, md5) // 1 sec
+	if err != nil {
+		return "", err
 	}
-	wgr.Wait()
-}
 
-// Crc32 ...
-func Crc32(wg *sync.WaitGroup, res *string, data string) {
-	*res = DataSignerCrc32(data) // 1 sec
-	wg.Done()
+	result := hashes[0] + "~" + hashes[1]
+	saveCheckpoint(stageSingle, data, result)
+	return result, nil
 }
 
 // MultiHash ...
 func MultiHash(in, out chan interface{}) {
+	hashStage(in, out, multiHash)
+}
+
+func multiHash(it Item, data string) (string, error) {
+	if result, ok := SignerCheckpoint.Lookup(stageMulti, data); ok {
+		return result, nil
+	}
+
+	mult := make([]string, 6)
+	for i := range mult {
+		mult[i] = strconv.Itoa(i) + data
+	}
+	mult, err := crc32All(it, mult...) // 1 sec
+	if err != nil {
+		return "", err
+	}
+
+	result := strings.Join(mult, "")
+	saveCheckpoint(stageMulti, data, result)
+	return result, nil
+}
+
+// hashStage общий обход входа для SingleHash и MultiHash: каждый элемент считается в своей горутине,
+// выброшенные раньше элементы (*ItemError) проходят дальше как есть
+func hashStage(in, out chan interface{}, hash func(it Item, data string) (string, error)) {
 	var wgr sync.WaitGroup
-	for step1 := range in {
+	for step := range in {
+		if dropped, ok := step.(*ItemError); ok {
+			out <- dropped
+			continue
+		}
 		wgr.Add(1)
-		go func(step1 interface{}) {
-			data := fmt.Sprintf("%v", step1)
-			var wg sync.WaitGroup
-			mult := make([]string, 6)
-			for i := 0; i < 6; i++ {
-				wg.Add(1)
-				go func(j int) {
-					mult[j] = DataSignerCrc32(strconv.Itoa(j) + data)
-					wg.Done()
-				}(i)
+		go func(step interface{}) {
+			defer wgr.Done()
+			trackWork()
+			defer trackWork()
+			it, wrapped := asItem(step)
+			if it.expired() {
+				out <- &ItemError{Item: it, Err: ErrDeadlineExceeded}
+				return
 			}
-			wg.Wait() // 1 sec
 
-			result := strings.Join(mult, "")
-
-			out <- result
-			wgr.Done()
-		}(step1)
+			result, err := hash(it, fmt.Sprintf("%v", it.Data))
+			if err != nil {
+				out <- &ItemError{Item: it, Err: err}
+				return
+			}
+			if !wrapped {
+				out <- result
+				return
+			}
+			it.Data = result
+			out <- it
+		}(step)
 	}
 	wgr.Wait()
 }
 
+// crc32All параллельно считает DataSignerCrc32 от каждой строки
+func crc32All(it Item, data ...string) ([]string, error) {
+	hashes := make([]string, len(data))
+	errs := make([]error, len(data))
+	var wg sync.WaitGroup
+	for i := range data {
+		wg.Add(1)
+		go func(j int) {
+			defer wg.Done()
+			trackWork()
+			defer trackWork()
+			if errs[j] = crc32Sched.Acquire(it); errs[j] != nil {
+				return
+			}
+			hashes[j] = DataSignerCrc32(data[j])
+			crc32Sched.Release()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
+
 // CombineResults ...
+// выброшенные элементы (*ItemError) в результат не попадают, но пишутся в лог
 func CombineResults(in, out chan interface{}) {
 	var wgr sync.WaitGroup
 	var mx sync.RWMutex
 
 	result := make([]string, 0)
 	for step2 := range in {
+		if dropped, ok := step2.(*ItemError); ok {
+			log.Println("combine results:", dropped)
+			continue
+		}
 		wgr.Add(1)
 		go func(step2 interface{}) {
 			data, ok := step2.(string)
+			if it, isItem := step2.(Item); isItem {
+				data, ok = it.Data.(string)
+			}
 			if ok {
 				mx.Lock()
 				fmt.Println(data, " : ", len(result))
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SimReport итог прогона конвейера в виртуальном времени
+type SimReport struct {
+	Elapsed          time.Duration // длина критического пути
+	Md5Calls         int
+	Crc32Calls       int
+	MaxMd5Parallel   int // больше 1 - значит был перегрев
+	MaxCrc32Parallel int
+	Stuck            bool // все горутины встали, а спящих нет
+}
+
+// Simulate запускает конвейер на FakeClock: DataSignerMd5/DataSignerCrc32/OverheatLock
+// не спят по-настоящему, время сдвигается, как только все горутины конвейера встали.
+// Подменяет глобальные переменные, поэтому параллельно с другими тестами не запускать
+func Simulate(jobs ...job) SimReport {
+	fc := NewFakeClock(time.Unix(0, 0))
+
+	var md5Calls, crcCalls, md5Active, crcActive, md5Max, crcMax int32
+	origClock, origMd5, origCrc32 := clock, DataSignerMd5, DataSignerCrc32
+	defer func() {
+		clock, DataSignerMd5, DataSignerCrc32 = origClock, origMd5, origCrc32
+	}()
+
+	clock = fc
+	DataSignerMd5 = func(data string) string {
+		atomic.AddInt32(&md5Calls, 1)
+		storeMax(&md5Max, atomic.AddInt32(&md5Active, 1))
+		defer atomic.AddInt32(&md5Active, -1)
+		return origMd5(data)
+	}
+	DataSignerCrc32 = func(data string) string {
+		atomic.AddInt32(&crcCalls, 1)
+		storeMax(&crcMax, atomic.AddInt32(&crcActive, 1))
+		defer atomic.AddInt32(&crcActive, -1)
+		return origCrc32(data)
+	}
+
+	done := make(chan struct{})
+	root := make(chan uint64, 1)
+	go func() {
+		root <- goroutineID()
+		ExecutePipeline(jobs...)
+		close(done)
+	}()
+
+	pipeline := &goroutineTree{root: <-root, members: map[uint64]bool{}}
+	stuck := false
+	for pipeline.waitIdle(done) {
+		if !fc.AdvanceToNext() {
+			stuck = true
+			break
+		}
+	}
+
+	return SimReport{
+		Elapsed:          fc.Elapsed(),
+		Md5Calls:         int(atomic.LoadInt32(&md5Calls)),
+		Crc32Calls:       int(atomic.LoadInt32(&crcCalls)),
+		MaxMd5Parallel:   int(atomic.LoadInt32(&md5Max)),
+		MaxCrc32Parallel: int(atomic.LoadInt32(&crcMax)),
+		Stuck:            stuck,
+	}
+}
+
+// pipelineWork счётчик явно отслеживаемой работы конвейера: запуски и завершения воркеров hashStage
+// и вызовов crc32, засыпания и пробуждения на FakeClock. Пока он меняется, конвейер точно не встал
+// и снимать стеки незачем
+var pipelineWork int64
+
+func trackWork() {
+	atomic.AddInt64(&pipelineWork, 1)
+}
+
+// errNoParentID в стеках нет "created by ... in goroutine N" (так пишет только go 1.21 и новее):
+// чьи это горутины, не понять, а угадывать значит сдвигать время посреди работы
+var errNoParentID = errors.New("runtime.Stack has no parent goroutine ids, go 1.21 or newer is required")
+
+// goroutineTree горутины конвейера: root и все, кого запустили он и его потомки
+type goroutineTree struct {
+	root uint64
+	// members все горутины конвейера, которые попадались в снимках, в том числе завершившиеся:
+	// по ним узнаются потомки горутин, которых уже нет
+	members map[uint64]bool
+	buf     []byte
+	// parked какие состояния считать остановкой, по умолчанию parkedState
+	parked func(state string) bool
+}
+
+// waitIdle ждёт, пока все горутины конвейера не встанут на каналах, мьютексах, WaitGroup
+// или в FakeClock.Sleep: дальше без сдвига времени уже никто не продвинется.
+// Пока меняется pipelineWork, работа идёт; когда он замер, это подтверждается снимком
+// планировщика, а не угадывается по времени, так что ни нагрузка на машину,
+// ни посторонние горутины на результат не влияют.
+// Возвращает false, если конвейер завершился
+func (t *goroutineTree) waitIdle(done <-chan struct{}) bool {
+	for {
+		select {
+		case <-done:
+			return false
+		default:
+		}
+		seen := atomic.LoadInt64(&pipelineWork)
+		runtime.Gosched()
+		if atomic.LoadInt64(&pipelineWork) != seen || !t.idle() {
+			continue
+		}
+		// в снимке никого нет и когда конвейер уже завершился: done закрыт до выхода из root
+		select {
+		case <-done:
+			return false
+		default:
+			return true
+		}
+	}
+}
+
+// idle нет ли среди горутин конвейера работающих или готовых работать
+func (t *goroutineTree) idle() bool {
+	if len(t.buf) == 0 {
+		t.buf = make([]byte, 64<<10)
+	}
+	n := runtime.Stack(t.buf, true)
+	for n == len(t.buf) {
+		t.buf = make([]byte, 2*len(t.buf))
+		n = runtime.Stack(t.buf, true)
+	}
+
+	// родитель всегда старше потомка, так что по возрастанию id цепочки складываются за один проход
+	gs, err := parseGoroutines(t.buf[:n])
+	if err != nil {
+		panic("simulate: " + err.Error())
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i].id < gs[j].id })
+	alive := make(map[uint64]bool, len(gs))
+	for _, g := range gs {
+		alive[g.id] = true
+	}
+	parked := t.parked
+	if parked == nil {
+		parked = parkedState
+	}
+	idle := true
+	for _, g := range gs {
+		if g.id != t.root && !t.members[g.parent] {
+			// родитель чужой или завершился, не попав ни в один снимок: запущен ли он конвейером,
+			// неизвестно. Запущенное раньше конвейера точно чужое, остальное на всякий случай своё
+			if alive[g.parent] || g.parent <= t.root {
+				continue
+			}
+		}
+		t.members[g.id] = true
+		if !parked(g.state) {
+			idle = false
+		}
+	}
+	return idle
+}
+
+type goroutineState struct {
+	id, parent uint64
+	state      string // из заголовка: running, chan receive, sleep...
+}
+
+// parseGoroutines горутины из вывода runtime.Stack(buf, true):
+//
+//	goroutine 12 [chan receive]:
+//	...
+//	created by main.hashStage in goroutine 7
+func parseGoroutines(stacks []byte) ([]goroutineState, error) {
+	res := []goroutineState{}
+	for _, stack := range strings.Split(string(stacks), "\n\n") {
+		header := strings.SplitN(stack, "\n", 2)[0]
+		g := goroutineState{}
+		if open, close := strings.IndexByte(header, '['), strings.IndexByte(header, ']'); open < 0 || close < open {
+			continue
+		} else {
+			g.state = header[open+1 : close]
+			g.id, _ = strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(header[:open], "goroutine")), 10, 64)
+		}
+		if i := strings.LastIndex(stack, "\ncreated by "); i >= 0 {
+			created := stack[i+1:]
+			if end := strings.IndexByte(created, '\n'); end >= 0 {
+				created = created[:end]
+			}
+			j := strings.LastIndex(created, " in goroutine ")
+			if j < 0 {
+				return nil, errNoParentID
+			}
+			g.parent, _ = strconv.ParseUint(created[j+len(" in goroutine "):], 10, 64)
+		}
+		res = append(res, g)
+	}
+	return res, nil
+}
+
+// parkedState состояния, из которых горутину выводит только другая горутина.
+// Остальные (running, runnable, syscall, настоящий time.Sleep) - работа ещё идёт
+func parkedState(state string) bool {
+	for _, prefix := range []string{"chan ", "select", "sync.", "semacquire", "IO wait"} {
+		if strings.HasPrefix(state, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// goroutineID id текущей горутины из заголовка её стека
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	id, _ := strconv.ParseUint(strings.Fields(strings.TrimPrefix(string(buf), "goroutine "))[0], 10, 64)
+	return id
+}
+
+func storeMax(max *int32, v int32) {
+	for {
+		cur := atomic.LoadInt32(max)
+		if v <= cur || atomic.CompareAndSwapInt32(max, cur, v) {
+			return
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+const signerExpected = "1173136728138862632818075107442090076184424490584241521304_1696913515191343735512658979631549563179965036907783101867_27225454331033649287118297354036464389062965355426795162684_29568666068035183841425683795340791879727309630931025356555_3994492081516972096677631278379039212655368881548151736_4958044192186797981418233587017209679042592862002427381542_4958044192186797981418233587017209679042592862002427381542"
+
+func signerJobs(inputData []int, result *string) []job {
+	return []job{
+		job(func(in, out chan interface{}) {
+			for _, fibNum := range inputData {
+				out <- fibNum
+			}
+		}),
+		job(SingleHash),
+		job(MultiHash),
+		job(CombineResults),
+		job(func(in, out chan interface{}) {
+			*result, _ = (<-in).(string)
+		}),
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	fc := NewFakeClock(time.Unix(0, 0))
+	var wg sync.WaitGroup
+	order := make(chan time.Duration, 2)
+	for _, d := range []time.Duration{2 * time.Second, time.Second} {
+		wg.Add(1)
+		go func(d time.Duration) {
+			defer wg.Done()
+			fc.Sleep(d)
+			order <- fc.Elapsed()
+		}(d)
+	}
+	for fc.Sleepers() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	fc.Advance(time.Second)
+	if got := <-order; got != time.Second {
+		t.Errorf("first wake at %s, expected 1s", got)
+	}
+	if !fc.AdvanceToNext() {
+		t.Fatal("nobody to wake")
+	}
+	wg.Wait()
+	if got := <-order; got != 2*time.Second {
+		t.Errorf("second wake at %s, expected 2s", got)
+	}
+	if fc.AdvanceToNext() {
+		t.Error("nobody should sleep")
+	}
+}
+
+func TestSignerSimulated(t *testing.T) {
+	inputData := []int{0, 1, 1, 2, 3, 5, 8}
+	result := "NOT_SET"
+
+	rep := Simulate(signerJobs(inputData, &result)...)
+
+	if result != signerExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, signerExpected)
+	}
+	if rep.Stuck {
+		t.Fatal("pipeline stuck")
+	}
+	if rep.Elapsed > 3*time.Second {
+		t.Errorf("critical path too long\nGot: %s\nExpected: <%s", rep.Elapsed, 3*time.Second)
+	}
+	if rep.MaxMd5Parallel != 1 {
+		t.Errorf("DataSignerMd5 called in parallel: %d", rep.MaxMd5Parallel)
+	}
+	if rep.MaxCrc32Parallel < 2 {
+		t.Errorf("DataSignerCrc32 is not parallel: %d", rep.MaxCrc32Parallel)
+	}
+	if rep.Md5Calls != len(inputData) || rep.Crc32Calls != len(inputData)*8 {
+		t.Errorf("not enough hash-func calls: md5 %d, crc32 %d", rep.Md5Calls, rep.Crc32Calls)
+	}
+}
+
+func TestSimulateIgnoresOtherGoroutines(t *testing.T) {
+	inputData := []int{0, 1, 1, 2, 3, 5, 8}
+	var result string
+	quiet := Simulate(signerJobs(inputData, &result)...)
+
+	// посторонние горутины всё время рождаются, работают и спят по-настоящему
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				time.Sleep(time.Microsecond)
+			}()
+			runtime.Gosched()
+		}
+	}()
+	noisy := Simulate(signerJobs(inputData, &result)...)
+	close(stop)
+	wg.Wait()
+
+	if result != signerExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, signerExpected)
+	}
+	if noisy != quiet {
+		t.Errorf("simulation depends on other goroutines\nGot: %+v\nExpected: %+v", noisy, quiet)
+	}
+}
+
+func TestParseGoroutines(t *testing.T) {
+	stacks := `goroutine 7 [semacquire]:
+sync.runtime_Semacquire(0xc000012345)
+created by main.ExecutePipeline in goroutine 6
+	/src/signer.go:25 +0x85
+
+goroutine 12 [running]:
+main.hashStage.func1()
+created by main.hashStage in goroutine 7
+	/src/signer.go:97 +0x8c`
+	gs, err := parseGoroutines([]byte(stacks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []goroutineState{{7, 6, "semacquire"}, {12, 7, "running"}}
+	if len(gs) != len(expected) || gs[0] != expected[0] || gs[1] != expected[1] {
+		t.Errorf("expected %+v, got %+v", expected, gs)
+	}
+
+	// до go 1.21 родитель не пишется, молча считать такие горутины чужими нельзя
+	old := `goroutine 12 [running]:
+main.hashStage.func1()
+created by main.hashStage
+	/src/signer.go:97 +0x8c`
+	if _, err := parseGoroutines([]byte(old)); err != errNoParentID {
+		t.Errorf("expected errNoParentID, got %v", err)
+	}
+}
+
+func TestSimulateOverheat(t *testing.T) {
+	rep := Simulate(
+		job(func(in, out chan interface{}) {
+			var wg sync.WaitGroup
+			for i := 0; i < 2; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					DataSignerMd5("data")
+				}()
+			}
+			wg.Wait()
+		}),
+	)
+
+	if rep.MaxMd5Parallel != 2 {
+		t.Errorf("expected parallel md5 calls, got %d", rep.MaxMd5Parallel)
+	}
+	// второй вызов ждёт 1 сек перегрева
+	if rep.Elapsed < time.Second {
+		t.Errorf("overheat is not simulated: %s", rep.Elapsed)
+	}
+}
+
+func TestSimulateStuck(t *testing.T) {
+	rep := Simulate(
+		job(func(in, out chan interface{}) {
+			out <- 1
+		}),
+		job(func(in, out chan interface{}) {}),
+	)
+	if !rep.Stuck {
+		t.Error("blocked sender is not reported")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+// ahoCorasick ищет все шаблоны за один проход по строке. Автомат развёрнут в полную таблицу
+// переходов, алфавит сжат до классов: все байты, которых нет в шаблонах, - один класс 0,
+// так что таблица занимает states*classes, а не states*256
+type ahoCorasick struct {
+	classes  [256]int32
+	nclasses int
+	// delta[state*nclasses+class] следующее состояние, уже умноженное на nclasses и сдвинутое
+	// на бит влево; младший бит - в состоянии кончается какой-то шаблон
+	delta    []int32
+	outs     [][]int32 // какие шаблоны кончаются в состоянии, с учётом суффиксных ссылок
+	start    [256]bool // байты, с которых начинается хоть один шаблон
+	npattern int
+}
+
+// newAhoCorasick автомат по шаблонам, номер шаблона - его индекс в patterns.
+// nil, если в шаблонах встречаются все 256 байт: для байт не из шаблонов не остаётся класса
+func newAhoCorasick(patterns [][]byte) *ahoCorasick {
+	ac := &ahoCorasick{nclasses: 1, npattern: len(patterns)}
+	for _, p := range patterns {
+		for _, c := range p {
+			if ac.classes[c] != 0 {
+				continue
+			}
+			if ac.nclasses == 256 {
+				return nil
+			}
+			ac.classes[c] = int32(ac.nclasses)
+			ac.nclasses++
+		}
+	}
+
+	// бор: -1 - перехода нет
+	trie := [][]int32{ac.newState()}
+	outs := [][]int32{nil}
+	for i, p := range patterns {
+		if len(p) > 0 {
+			ac.start[p[0]] = true
+		}
+		state := int32(0)
+		for _, c := range p {
+			next := &trie[state][ac.classes[c]]
+			if *next < 0 {
+				*next = int32(len(trie))
+				trie = append(trie, ac.newState())
+				outs = append(outs, nil)
+			}
+			state = *next
+		}
+		outs[state] = append(outs[state], int32(i))
+	}
+
+	// обход в ширину: суффиксная ссылка состояния уже посчитана, когда до него доходим,
+	// поэтому недостающие переходы можно брать из неё
+	fail := make([]int32, len(trie))
+	queue := []int32{}
+	for class, next := range trie[0] {
+		if next < 0 {
+			trie[0][class] = 0
+		} else {
+			queue = append(queue, next)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		outs[state] = append(outs[state], outs[fail[state]]...)
+		for class, next := range trie[state] {
+			if next < 0 {
+				trie[state][class] = trie[fail[state]][class]
+				continue
+			}
+			fail[next] = trie[fail[state]][class]
+			queue = append(queue, next)
+		}
+	}
+
+	ac.delta = make([]int32, 0, len(trie)*ac.nclasses)
+	for _, row := range trie {
+		for _, next := range row {
+			flag := int32(0)
+			if len(outs[next]) > 0 {
+				flag = 1
+			}
+			ac.delta = append(ac.delta, next*int32(ac.nclasses)<<1|flag)
+		}
+	}
+	ac.outs = outs
+	return ac
+}
+
+func (ac *ahoCorasick) newState() []int32 {
+	row := make([]int32, ac.nclasses)
+	for i := range row {
+		row[i] = -1
+	}
+	return row
+}
+
+// find отмечает в found шаблоны, которые есть в line, и говорит, сколько их нашлось.
+// found должен быть не короче числа шаблонов и заполнен false
+func (ac *ahoCorasick) find(line []byte, found []bool) int {
+	n, state := 0, int32(0)
+	for i := 0; i < len(line); i++ {
+		if state == 0 {
+			// из корня автомат уходит только по первому байту шаблона, до него можно бежать
+			// без таблицы переходов
+			for i < len(line) && !ac.start[line[i]] {
+				i++
+			}
+			if i == len(line) {
+				break
+			}
+		}
+		state = ac.delta[state>>1+ac.classes[line[i]]]
+		if state&1 == 0 {
+			continue
+		}
+		for _, p := range ac.outs[state>>1/int32(ac.nclasses)] {
+			if !found[p] {
+				found[p] = true
+				n++
+				if n == ac.npattern {
+					return n
+				}
+			}
+		}
+	}
+	return n
+}
@@ -18,8 +18,14 @@ func SlowSearch(out io.Writer) {
 	if err != nil {
 		panic(err)
 	}
+	defer file.Close()
 
-	fileContents, err := ioutil.ReadAll(file)
+	SlowSearchReader(file, out)
+}
+
+// SlowSearchReader исходная реализация над произвольным источником, эталон для сравнения
+func SlowSearchReader(in io.Reader, out io.Writer) {
+	fileContents, err := ioutil.ReadAll(in)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,249 @@
+// Package datagen генерирует файлы в формате data/users.txt: по пользователю в строке,
+// строки разделены \n, в конце перевода строки нет. Одинаковые Config дают одинаковый файл
+package datagen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Config параметры генерации
+type Config struct {
+	// Users сколько строк
+	Users int
+	Seed  int64
+	// Adversarial доля неудобных строк от 0 до 1: unicode, экранирование, пропущенные поля,
+	// длинные массивы браузеров. 0 - только обычные строки, как в users.txt
+	Adversarial float64
+	// Browsers сколько браузеров у обычного пользователя, по умолчанию 4 как в users.txt
+	Browsers int
+}
+
+// Generate пишет cfg.Users строк в w
+func Generate(w io.Writer, cfg Config) error {
+	g := New(cfg)
+	bw := bufio.NewWriter(w)
+	line := []byte{}
+	for i := 0; i < cfg.Users; i++ {
+		if i > 0 {
+			bw.WriteByte('\n')
+		}
+		line = g.Line(line[:0])
+		if _, err := bw.Write(line); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Generator выдаёт строки по одной
+type Generator struct {
+	cfg Config
+	rnd *rand.Rand
+}
+
+// New генератор с настройками cfg, Users не используется
+func New(cfg Config) *Generator {
+	if cfg.Browsers <= 0 {
+		cfg.Browsers = 4
+	}
+	return &Generator{cfg: cfg, rnd: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+// Line дописывает в dst следующего пользователя без перевода строки
+func (g *Generator) Line(dst []byte) []byte {
+	if g.cfg.Adversarial > 0 && g.rnd.Float64() < g.cfg.Adversarial {
+		return g.adversarial(dst)
+	}
+	return g.user(dst)
+}
+
+// user обычная строка: те же поля и в том же порядке, что в users.txt
+func (g *Generator) user(dst []byte) []byte {
+	name, email := g.person()
+	dst = append(dst, `{"browsers":[`...)
+	for i := 0; i < g.cfg.Browsers; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendString(dst, g.UserAgent())
+	}
+	dst = append(dst, `],"company":`...)
+	dst = appendString(dst, g.pick(companies))
+	dst = append(dst, `,"country":`...)
+	dst = appendString(dst, g.pick(countries))
+	dst = append(dst, `,"email":`...)
+	dst = appendString(dst, email)
+	dst = append(dst, `,"job":`...)
+	dst = appendString(dst, g.pick(jobs))
+	dst = append(dst, `,"name":`...)
+	dst = appendString(dst, name)
+	dst = append(dst, `,"phone":`...)
+	dst = appendString(dst, fmt.Sprintf("%03d-%02d-%02d", g.rnd.Intn(1000), g.rnd.Intn(100), g.rnd.Intn(100)))
+	return append(dst, '}')
+}
+
+func (g *Generator) person() (name, email string) {
+	first, last := g.pick(firstNames), g.pick(lastNames)
+	return first + " " + last, first + last + "@" + g.pick(domains)
+}
+
+func (g *Generator) pick(list []string) string {
+	return list[g.rnd.Intn(len(list))]
+}
+
+// field поле неудобной строки. raw - значение уже в json
+type field struct {
+	key string
+	raw []byte
+}
+
+// adversarial строка, которую разбирать неудобно, но которая остаётся корректным json
+func (g *Generator) adversarial(dst []byte) []byte {
+	name, email := g.person()
+	browsers := make([]string, 1+g.rnd.Intn(g.cfg.Browsers))
+	for i := range browsers {
+		browsers[i] = g.UserAgent()
+	}
+
+	switch g.rnd.Intn(5) {
+	case 0:
+		// unicode в имени и браузерах
+		name = g.pick(unicodeNames)
+		browsers[0] += " " + g.pick(unicodeNames)
+	case 1:
+		// кавычки и обратные слеши, которые придётся экранировать
+		name = `Jo"hn \"the\\ Quote"`
+		email = `o"reilly\@x.org`
+		browsers[0] = strings.Replace(browsers[0], "(", `("\`, 1)
+	case 2:
+		// длинный массив браузеров
+		browsers = make([]string, 200+g.rnd.Intn(800))
+		for i := range browsers {
+			browsers[i] = g.UserAgent()
+		}
+	case 3:
+		// строка длиннее буфера bufio.Scanner
+		browsers[0] += " " + strings.Repeat("x", 70<<10)
+	case 4:
+		// email с несколькими @
+		email = strings.Replace(email, "@", "@@", 1) + "@alias"
+	}
+
+	list := []byte{'['}
+	for i, b := range browsers {
+		if i > 0 {
+			list = append(list, ',')
+		}
+		list = g.appendEscaped(list, b)
+		if g.rnd.Intn(20) == 0 {
+			// не-строки SlowSearch пропускает
+			list = append(list, ","+g.pick([]string{"1", "null", "true", `{"a":["b"]}`, "[]", "-1.5e3"})...)
+		}
+	}
+	list = append(list, ']')
+
+	fields := []field{
+		{"browsers", list},
+		{"company", g.appendEscaped(nil, g.pick(companies))},
+		{"country", g.appendEscaped(nil, g.pick(countries))},
+		{"email", g.appendEscaped(nil, email)},
+		{"name", g.appendEscaped(nil, name)},
+		{"job", []byte(`{"title":"x","tags":["a","}"],"level":3}`)},
+	}
+	// пропущенные поля и null вместо значения
+	for i := range fields {
+		switch g.rnd.Intn(12) {
+		case 0:
+			fields[i].raw = nil
+		case 1:
+			fields[i].raw = []byte("null")
+		}
+	}
+	g.rnd.Shuffle(len(fields), func(i, j int) { fields[i], fields[j] = fields[j], fields[i] })
+
+	dst = append(dst, '{')
+	first := true
+	for _, f := range fields {
+		if f.raw == nil {
+			continue
+		}
+		if !first {
+			dst = append(dst, ',')
+		}
+		first = false
+		dst = append(dst, g.space()...)
+		dst = appendString(dst, f.key)
+		dst = append(dst, g.space()...)
+		dst = append(dst, ':')
+		dst = append(dst, g.space()...)
+		dst = append(dst, f.raw...)
+		dst = append(dst, g.space()...)
+	}
+	return append(dst, '}')
+}
+
+func (g *Generator) space() string {
+	return []string{"", "", "", " ", "\t", " \r "}[g.rnd.Intn(6)]
+}
+
+// appendEscaped как appendString, но часть символов экранирована без необходимости: \/, \uXXXX
+func (g *Generator) appendEscaped(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\' || r < 0x20:
+			dst = appendEscapedRune(dst, r)
+		case r == '/' && g.rnd.Intn(3) == 0:
+			dst = append(dst, `\/`...)
+		case g.rnd.Intn(30) == 0:
+			dst = appendUnicodeEscape(dst, r)
+		default:
+			dst = append(dst, string(r)...)
+		}
+	}
+	return append(dst, '"')
+}
+
+func appendString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	for _, r := range s {
+		if r == '"' || r == '\\' || r < 0x20 {
+			dst = appendEscapedRune(dst, r)
+		} else {
+			dst = append(dst, string(r)...)
+		}
+	}
+	return append(dst, '"')
+}
+
+func appendEscapedRune(dst []byte, r rune) []byte {
+	switch r {
+	case '"':
+		return append(dst, `\"`...)
+	case '\\':
+		return append(dst, `\\`...)
+	case '\n':
+		return append(dst, `\n`...)
+	case '\t':
+		return append(dst, `\t`...)
+	}
+	return appendUnicodeEscape(dst, r)
+}
+
+// appendUnicodeEscape \uXXXX, вне BMP - суррогатной парой
+func appendUnicodeEscape(dst []byte, r rune) []byte {
+	if r > 0xFFFF {
+		r1, r2 := utf16.EncodeRune(r)
+		return appendUnicodeEscape(appendUnicodeEscape(dst, r1), r2)
+	}
+	dst = append(dst, `\u`...)
+	hex := strconv.FormatInt(int64(r), 16)
+	dst = append(dst, "0000"[len(hex):]...)
+	return append(dst, hex...)
+}
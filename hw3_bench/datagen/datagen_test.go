@@ -0,0 +1,123 @@
+package datagen
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func generate(t *testing.T, cfg Config) []byte {
+	buf := new(bytes.Buffer)
+	if err := Generate(buf, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGenerateDeterministic(t *testing.T) {
+	cfg := Config{Users: 500, Seed: 42, Adversarial: 0.3}
+	first, second := generate(t, cfg), generate(t, cfg)
+	if !bytes.Equal(first, second) {
+		t.Error("same config must give same data")
+	}
+	cfg.Seed++
+	if bytes.Equal(first, generate(t, cfg)) {
+		t.Error("different seeds must give different data")
+	}
+}
+
+func TestGenerateFormat(t *testing.T) {
+	data := generate(t, Config{Users: 300, Seed: 1})
+	if bytes.HasSuffix(data, []byte("\n")) {
+		t.Error("no trailing newline expected, like in users.txt")
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(lines) != 300 {
+		t.Fatalf("expected 300 lines, got %d", len(lines))
+	}
+
+	for i, line := range lines {
+		user := struct {
+			Browsers []string
+			Company  string
+			Country  string
+			Email    string
+			Job      string
+			Name     string
+			Phone    string
+		}{}
+		if err := json.Unmarshal([]byte(line), &user); err != nil {
+			t.Fatalf("[%d] %s: %s", i, err, line)
+		}
+		if len(user.Browsers) != 4 || user.Company == "" || user.Country == "" || user.Name == "" ||
+			user.Job == "" || user.Phone == "" || strings.Count(user.Email, "@") != 1 {
+			t.Fatalf("[%d] regular user must have all fields: %s", i, line)
+		}
+	}
+}
+
+func TestGenerateAdversarial(t *testing.T) {
+	data := generate(t, Config{Users: 600, Seed: 7, Adversarial: 1})
+
+	features := map[string]bool{}
+	for i, line := range strings.Split(string(data), "\n") {
+		user := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &user); err != nil {
+			t.Fatalf("[%d] adversarial line must stay valid json: %s", i, err)
+		}
+		browsers, _ := user["browsers"].([]interface{})
+		name, _ := user["name"].(string)
+		email, _ := user["email"].(string)
+		switch {
+		case len(browsers) >= 200:
+			features["long array"] = true
+		case len(line) > 64<<10:
+			features["long line"] = true
+		}
+		if _, ok := user["email"]; !ok {
+			features["missing field"] = true
+		}
+		if strings.Contains(line, `\"`) && strings.Contains(name, `"`) {
+			features["escaped quotes"] = true
+		}
+		if strings.Contains(line, `\u`) {
+			features["unicode escapes"] = true
+		}
+		if strings.ContainsAny(name, "ИЁ李😀") {
+			features["unicode name"] = true
+		}
+		if strings.Count(email, "@") > 1 {
+			features["several @"] = true
+		}
+		for _, b := range browsers {
+			if _, ok := b.(string); !ok {
+				features["non-string browser"] = true
+			}
+		}
+	}
+
+	for _, f := range []string{"long array", "long line", "missing field", "escaped quotes", "unicode escapes",
+		"unicode name", "several @", "non-string browser"} {
+		if !features[f] {
+			t.Errorf("no %s in adversarial data", f)
+		}
+	}
+}
+
+func TestUserAgentDistribution(t *testing.T) {
+	g := New(Config{Seed: 3})
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		ua := g.UserAgent()
+		for _, marker := range []string{"Chrome/", "Firefox/", "MSIE", "Android", "iPhone", "bot"} {
+			if strings.Contains(ua, marker) {
+				counts[marker]++
+			}
+		}
+	}
+	// Chrome встречается чаще IE, IE чаще ботов, и все семейства есть
+	if counts["Chrome/"] <= counts["MSIE"] || counts["MSIE"] <= counts["bot"] || counts["bot"] == 0 || counts["iPhone"] == 0 {
+		t.Errorf("unexpected distribution %v", counts)
+	}
+}
@@ -0,0 +1,120 @@
+package datagen
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// uaTemplate семейство браузеров, weight - относительная частота
+type uaTemplate struct {
+	weight int
+	gen    func(r *rand.Rand) string
+}
+
+// примерно как в users.txt: больше всего Chrome, Firefox и IE, заметная доля мобильных,
+// немного ботов и старых телефонов
+var uaTemplates = []uaTemplate{
+	{25, func(r *rand.Rand) string {
+		return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.%d.%d Safari/537.36",
+			pickRand(r, desktopPlatforms), 20+r.Intn(40), 1000+r.Intn(2000), r.Intn(150))
+	}},
+	{15, func(r *rand.Rand) string {
+		v := 3 + r.Intn(50)
+		return fmt.Sprintf("Mozilla/5.0 (%s; rv:%d.0) Gecko/20100101 Firefox/%d.0", pickRand(r, desktopPlatforms), v, v)
+	}},
+	{12, func(r *rand.Rand) string {
+		return fmt.Sprintf("Mozilla/4.0 (compatible; MSIE %d.0; Windows NT %s; Trident/%d.0)",
+			5+r.Intn(6), pickRand(r, windowsNT), 4+r.Intn(3))
+	}},
+	{4, func(r *rand.Rand) string {
+		return fmt.Sprintf("Mozilla/5.0 (Windows NT %s; WOW64; Trident/7.0; rv:11.0) like Gecko", pickRand(r, windowsNT))
+	}},
+	{10, func(r *rand.Rand) string {
+		return fmt.Sprintf("Mozilla/5.0 (Linux; U; Android %d.%d; en-us; %s Build/%s) AppleWebKit/533.1 (KHTML, like Gecko) Version/4.0 Mobile Safari/533.1",
+			1+r.Intn(4), r.Intn(5), pickRand(r, androidDevices), pickRand(r, androidBuilds))
+	}},
+	{8, func(r *rand.Rand) string {
+		return fmt.Sprintf("Mozilla/5.0 (Linux; Android %d.%d.%d; %s Build/%s) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.%d.%d Mobile Safari/537.36",
+			4+r.Intn(3), r.Intn(5), r.Intn(3), pickRand(r, androidDevices), pickRand(r, androidBuilds), 30+r.Intn(20), 1000+r.Intn(2000), r.Intn(150))
+	}},
+	{8, func(r *rand.Rand) string {
+		major := 5 + r.Intn(5)
+		return fmt.Sprintf("Mozilla/5.0 (%s; CPU %s OS %d_%d like Mac OS X) AppleWebKit/601.1.46 (KHTML, like Gecko) Version/%d.0 Mobile/13C75 Safari/601.1",
+			pickRand(r, []string{"iPhone", "iPad"}), pickRand(r, []string{"iPhone", ""}), major, r.Intn(4), major)
+	}},
+	{5, func(r *rand.Rand) string {
+		return fmt.Sprintf("Mozilla/5.0 (Macintosh; Intel Mac OS X 10_%d_%d) AppleWebKit/600.%d (KHTML, like Gecko) Version/%d.0 Safari/600.%d",
+			6+r.Intn(6), r.Intn(9), r.Intn(9), 5+r.Intn(5), r.Intn(9))
+	}},
+	{5, func(r *rand.Rand) string {
+		return fmt.Sprintf("Opera/9.80 (%s) Presto/2.%d.%d Version/%d.%d", pickRand(r, []string{"Windows NT 6.1; U; en", "X11; Linux x86_64; U; ru", "Macintosh; Intel Mac OS X 10.6.8; U; fr"}),
+			8+r.Intn(5), 100+r.Intn(300), 10+r.Intn(3), r.Intn(70))
+	}},
+	{3, func(r *rand.Rand) string {
+		return fmt.Sprintf("Opera/9.80 (%s; Opera Mini/%d.%d.%d/%d.%d; U; en) Presto/2.8.119 Version/11.10",
+			pickRand(r, []string{"Android", "J2ME/MIDP", "iPhone"}), 4+r.Intn(4), r.Intn(10), 10000+r.Intn(30000), r.Intn(40), r.Intn(1000))
+	}},
+	// Windows Phone пишет и Android, и IEMobile: подстроки "Android" и "MSIE" тут врут
+	{2, func(r *rand.Rand) string {
+		return fmt.Sprintf("Mozilla/5.0 (Mobile; Windows Phone 8.1; Android 4.0; ARM; Trident/7.0; Touch; rv:11.0; IEMobile/11.0; NOKIA; Lumia %d) like iPhone OS 7_0_3 Mac OS X AppleWebKit/537 (KHTML, like Gecko) Mobile Safari/537",
+			500+r.Intn(500))
+	}},
+	{1, func(r *rand.Rand) string {
+		return fmt.Sprintf("Mozilla/5.0 (compatible; MSIE 9.0; Windows Phone OS 7.5; Trident/5.0; IEMobile/9.0; %s)", pickRand(r, []string{"NOKIA; Lumia 800", "HTC; Radar", "SAMSUNG; SGH-i917"}))
+	}},
+	{2, func(r *rand.Rand) string {
+		return pickRand(r, bots)
+	}},
+	{2, func(r *rand.Rand) string {
+		return fmt.Sprintf("%s/%d.0 (%02d.%02d) Profile/MIDP-2.0 Configuration/CLDC-1.1", pickRand(r, []string{"Nokia6230i", "SonyEricssonK750i", "SAMSUNG-SGH-E250", "LG-KG800"}),
+			1+r.Intn(2), r.Intn(10), r.Intn(100))
+	}},
+}
+
+var uaTotalWeight = func() int {
+	total := 0
+	for _, t := range uaTemplates {
+		total += t.weight
+	}
+	return total
+}()
+
+// UserAgent случайный браузер из распределения, похожего на users.txt
+func (g *Generator) UserAgent() string {
+	n := g.rnd.Intn(uaTotalWeight)
+	for _, t := range uaTemplates {
+		if n < t.weight {
+			return t.gen(g.rnd)
+		}
+		n -= t.weight
+	}
+	panic("unreachable")
+}
+
+func pickRand(r *rand.Rand, list []string) string {
+	return list[r.Intn(len(list))]
+}
+
+var desktopPlatforms = []string{
+	"Windows NT 6.1; WOW64",
+	"Windows NT 10.0; Win64; x64",
+	"Windows NT 5.1",
+	"Macintosh; Intel Mac OS X 10_9_3",
+	"X11; Linux x86_64",
+	"X11; Ubuntu; Linux i686",
+	"X11; FreeBSD amd64",
+}
+
+var windowsNT = []string{"5.1", "6.0", "6.1", "6.2", "6.3", "10.0"}
+
+var androidDevices = []string{"Nexus One", "SCH-I800", "GT-I9300", "SM-G900A", "HTC Desire", "Xoom", "LG-P500", "Milestone"}
+
+var androidBuilds = []string{"FROYO", "GRJ22", "KOT49H", "JSS15J", "ERD62", "MR1", "IMM76D"}
+
+var bots = []string{
+	"Googlebot/2.1 ( http://www.googlebot.com/bot.html)",
+	"msnbot/1.1 ( http://search.msn.com/msnbot.htm)",
+	"Mozilla/5.0 (compatible; Yahoo! Slurp; http://help.yahoo.com/help/us/ysearch/slurp)",
+	"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+	"Wget/1.12 (freebsd8.1)",
+}
@@ -0,0 +1,24 @@
+package datagen
+
+var firstNames = []string{
+	"Sharon", "Jonathan", "Maria", "James", "Linda", "Robert", "Patricia", "Michael", "Barbara", "William",
+	"Elizabeth", "David", "Jennifer", "Richard", "Susan", "Joseph", "Margaret", "Thomas", "Dorothy", "Charles",
+}
+
+var lastNames = []string{
+	"Crawford", "Morris", "Smith", "Johnson", "Williams", "Brown", "Jones", "Miller", "Davis", "Garcia",
+	"Rodriguez", "Wilson", "Martinez", "Anderson", "Taylor", "Thomas", "Hernandez", "Moore", "Martin", "Jackson",
+}
+
+var domains = []string{"Muxo.edu", "Flashset.com", "Skinix.net", "Yodel.org", "Tagtune.mil", "Voonyx.biz", "Jabbertype.gov", "Rhyzio.name"}
+
+var companies = []string{"Flashpoint", "Muxo", "Skinix", "Yodel", "Tagtune", "Voonyx", "Jabbertype", "Rhyzio", "Thoughtbridge", "Livetube"}
+
+var countries = []string{"Dominican Republic", "Peru", "Russia", "China", "Brazil", "Indonesia", "France", "United States", "Nigeria", "Sweden"}
+
+var jobs = []string{"Programmer Analyst #{N}", "Web Designer #{N}", "Accountant #{N}", "Nurse", "Engineer", "Teacher", "Sales Associate"}
+
+// unicodeNames кириллица, CJK, арабская вязь, комбинируемые символы и символы вне BMP
+var unicodeNames = []string{
+	"Иван Петров", "Ёжик Туманов", "李小龙", "山田 太郎", "محمد علي", "Zoë Ångström", "émile", "😀 Smiley 🎉", "𝔘𝔫𝔦𝔠𝔬𝔡𝔢",
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression чем сжат вход
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// DetectCompression по первым байтам. Строка users.txt начинается с '{', так что с json не спутать
+func DetectCompression(head []byte) Compression {
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return CompressionGzip
+	case bytes.HasPrefix(head, zstdMagic):
+		return CompressionZstd
+	}
+	return CompressionNone
+}
+
+// readAheadBlock сколько распакованных байт отдаётся разбору за раз
+const readAheadBlock = 256 << 10
+
+// decompress распаковывает r на лету, если он сжат, иначе отдаёт как есть.
+// zstd распаковывает блоки в workers горутин. У gzip блоки зависят друг от друга,
+// так что параллелить можно только распаковку с разбором: она идёт в своей горутине.
+// close обязателен, он останавливает горутины распаковки
+func decompress(r io.Reader, workers int) (_ io.Reader, close func(), err error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	head, _ := br.Peek(len(zstdMagic))
+
+	switch DetectCompression(head) {
+	case CompressionGzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		ra := newReadAhead(zr)
+		return ra, ra.close, nil
+	case CompressionZstd:
+		if workers < 1 {
+			workers = 1
+		}
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(workers))
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr.Close, nil
+	}
+	return br, func() {}, nil
+}
+
+// readAhead читает src в своей горутине на несколько блоков вперёд
+type readAhead struct {
+	blocks chan []byte
+	free   chan []byte
+	stop   chan struct{}
+	cur    []byte
+	rest   []byte
+	err    error
+}
+
+func newReadAhead(src io.Reader) *readAhead {
+	const depth = 4
+	ra := &readAhead{
+		blocks: make(chan []byte, depth),
+		free:   make(chan []byte, depth+1),
+		stop:   make(chan struct{}),
+	}
+	for i := 0; i < depth+1; i++ {
+		ra.free <- make([]byte, readAheadBlock)
+	}
+	go ra.fill(src)
+	return ra
+}
+
+// fill блоки с данными в blocks, в конце блок nil и ошибка в err
+func (ra *readAhead) fill(src io.Reader) {
+	defer close(ra.blocks)
+	for {
+		var buf []byte
+		select {
+		case buf = <-ra.free:
+		case <-ra.stop:
+			return
+		}
+		// не io.ReadFull: он прячет io.ErrUnexpectedEOF обрезанного архива
+		n, err := 0, error(nil)
+		for n < len(buf) && err == nil {
+			var m int
+			m, err = src.Read(buf[n:])
+			n += m
+		}
+		if n > 0 {
+			select {
+			case ra.blocks <- buf[:n]:
+			case <-ra.stop:
+				return
+			}
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			// blocks читает только Read, а он увидит err после закрытия канала
+			ra.err = err
+			return
+		}
+	}
+}
+
+func (ra *readAhead) Read(p []byte) (int, error) {
+	if len(ra.rest) == 0 {
+		if ra.cur != nil {
+			ra.free <- ra.cur
+			ra.cur = nil
+		}
+		block, ok := <-ra.blocks
+		if !ok {
+			if ra.err != nil {
+				return 0, ra.err
+			}
+			return 0, io.EOF
+		}
+		ra.cur, ra.rest = block, block
+	}
+	n := copy(p, ra.rest)
+	ra.rest = ra.rest[n:]
+	return n, nil
+}
+
+func (ra *readAhead) close() {
+	close(ra.stop)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/moguchev/coursera_go/hw3_bench/datagen"
+)
+
+func gzipData(t testing.TB, data []byte, members int) []byte {
+	buf := new(bytes.Buffer)
+	// pigz и cat a.gz b.gz дают несколько gzip подряд
+	step := len(data)/members + 1
+	for len(data) > 0 {
+		n := step
+		if n > len(data) {
+			n = len(data)
+		}
+		w := gzip.NewWriter(buf)
+		w.Write(data[:n])
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data = data[n:]
+	}
+	return buf.Bytes()
+}
+
+func zstdData(t testing.TB, data []byte) []byte {
+	buf := new(bytes.Buffer)
+	w, err := zstd.NewWriter(buf, zstd.WithEncoderConcurrency(4), zstd.WithWindowSize(1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectCompression(t *testing.T) {
+	data := []byte(`{"browsers":[]}`)
+	cases := []struct {
+		data     []byte
+		expected Compression
+	}{
+		{data, CompressionNone},
+		{nil, CompressionNone},
+		{[]byte{0x1f}, CompressionNone},
+		{gzipData(t, data, 1), CompressionGzip},
+		{zstdData(t, data), CompressionZstd},
+	}
+	for i, c := range cases {
+		if got := DetectCompression(c.data); got != c.expected {
+			t.Errorf("%d: got %d, expected %d", i, got, c.expected)
+		}
+	}
+}
+
+func TestSearchCompressed(t *testing.T) {
+	data := generateUsers(t, datagen.Config{Users: 2000, Seed: 3, Adversarial: 0.05})
+	expected := new(bytes.Buffer)
+	if err := (&Searcher{}).Search(bytes.NewReader(data), expected, androidAndMSIE); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	inputs := map[string][]byte{
+		"users.txt.gz":  gzipData(t, data, 1),
+		"users.txt.zst": zstdData(t, data),
+		"multi.txt.gz":  gzipData(t, data, 7),
+	}
+	for name, compressed := range inputs {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, compressed, 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, workers := range []int{0, 3} {
+			s := &Searcher{Workers: workers}
+			out := new(bytes.Buffer)
+			if err := s.Search(bytes.NewReader(compressed), out, androidAndMSIE); err != nil {
+				t.Fatalf("[%s workers %d] %s", name, workers, err)
+			}
+			if out.String() != expected.String() {
+				t.Errorf("[%s workers %d] Search results not match", name, workers)
+			}
+
+			out.Reset()
+			if err := s.SearchFile(path, out, androidAndMSIE); err != nil {
+				t.Fatalf("[%s workers %d] %s", name, workers, err)
+			}
+			if out.String() != expected.String() {
+				t.Errorf("[%s workers %d] SearchFile results not match", name, workers)
+			}
+		}
+
+		ix, err := OpenIndex(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := new(bytes.Buffer)
+		if err := ix.Search(out, androidAndMSIE); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != expected.String() {
+			t.Errorf("[%s] Index.Search results not match", name)
+		}
+	}
+}
+
+func TestSearchCompressedTruncated(t *testing.T) {
+	data := generateUsers(t, datagen.Config{Users: 2000, Seed: 3})
+	for name, compressed := range map[string][]byte{
+		"gzip": gzipData(t, data, 1),
+		"zstd": zstdData(t, data),
+	} {
+		truncated := compressed[:len(compressed)/2]
+		// обрыв потока распознаётся по ошибке, а не только по тексту
+		for _, workers := range []int{0, 3} {
+			err := (&Searcher{Workers: workers}).Search(bytes.NewReader(truncated), ioutil.Discard, androidAndMSIE)
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("[%s workers %d] expected unexpected EOF on truncated input, got %v", name, workers, err)
+			}
+		}
+
+		path := filepath.Join(t.TempDir(), "users.txt."+name)
+		if err := ioutil.WriteFile(path, truncated, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := BuildIndex(path); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("[%s] expected unexpected EOF building index, got %v", name, err)
+		}
+	}
+}
+
+// heapPeak наибольший HeapAlloc сверх текущего, пока выполняется fn
+func heapPeak(fn func()) uint64 {
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	base, peak := ms.HeapAlloc, ms.HeapAlloc
+
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			runtime.ReadMemStats(&ms)
+			if ms.HeapAlloc > peak {
+				peak = ms.HeapAlloc
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	fn()
+	close(done)
+	<-sampled
+	return peak - base
+}
+
+func TestSearchCompressedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("large input is skipped in short mode")
+	}
+	data := generateUsers(t, datagen.Config{Users: 2000, Seed: 5})
+	if data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	const size = 48 << 20
+	copies := size/len(data) + 1
+
+	for _, workers := range []int{0, 4} {
+		// сжатый вход тоже не держим в памяти: он пишется в pipe по мере чтения
+		pr, pw := io.Pipe()
+		go func() {
+			zw, _ := gzip.NewWriterLevel(pw, gzip.BestSpeed)
+			for i := 0; i < copies; i++ {
+				if _, err := zw.Write(data); err != nil {
+					return
+				}
+			}
+			pw.CloseWithError(zw.Close())
+		}()
+
+		var err error
+		peak := heapPeak(func() {
+			err = (&Searcher{Workers: workers}).Search(pr, ioutil.Discard, androidAndMSIE)
+		})
+		pr.Close()
+		if err != nil {
+			t.Fatalf("[workers %d] %s", workers, err)
+		}
+		t.Logf("[workers %d] %d MB input, heap peak %d MB", workers, copies*len(data)>>20, peak>>20)
+		if peak > size/3 {
+			t.Errorf("[workers %d] heap grew by %d MB on %d MB input, expected streaming decode", workers, peak>>20, copies*len(data)>>20)
+		}
+	}
+}
+
+func BenchmarkSearchCompressed(b *testing.B) {
+	data := generateUsers(b, datagen.Config{Users: 20000, Seed: 1})
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{
+		{"plain", data},
+		{"gzip", gzipData(b, data, 1)},
+		{"zstd", zstdData(b, data)},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if err := (&Searcher{}).Search(bytes.NewReader(c.data), ioutil.Discard, androidAndMSIE); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,75 +1,51 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"os"
-	"strings"
-
-	"github.com/moguchev/coursera_go/hw3_bench/models"
+	"log"
+	"net/http"
+	"runtime"
 )
 
-var android = []byte("Android")
-var msie = []byte("MSIE")
+// androidAndMSIE исходный запрос: пользователи, у которых есть и Android, и MSIE
+var androidAndMSIE = And(Contains(FieldBrowser, "Android"), Contains(FieldBrowser, "MSIE"))
 
 // вам надо написать более быструю оптимальную этой функции
 func FastSearch(out io.Writer) {
-	// SlowSearch(out)
-	file, err := os.Open(filePath)
-	if err != nil {
-		panic(err)
-	}
-	defer file.Close()
-
-	seenBrowsers := make(map[string]struct{})
-
-	fmt.Fprintln(out, "found users:")
-
-	user := models.User{}
-	scanner := bufio.NewScanner(file)
-	for i := 0; scanner.Scan(); i++ {
-		if bytes.Contains(scanner.Bytes(), android) == false &&
-			bytes.Contains(scanner.Bytes(), msie) == false {
-			continue
-		}
-
-		err := user.UnmarshalJSON(scanner.Bytes())
-		if err != nil {
-			panic(err)
-		}
-
-		isAndroid := false
-		isMSIE := false
-
-		for _, browser := range user.Browsers {
-			if strings.Contains(browser, "Android") {
-				isAndroid = true
-				seenBrowsers[browser] = struct{}{}
-			}
-			if strings.Contains(browser, "MSIE") {
-				isMSIE = true
-				seenBrowsers[browser] = struct{}{}
-			}
-		}
+	FastSearchQuery(out, androidAndMSIE)
+}
 
-		if !(isAndroid && isMSIE) {
-			continue
-		}
-		email := strings.Replace(user.Email, "@", " [at] ", 1)
-		fmt.Fprintln(out, fmt.Sprintf("[%d] %s <%s>", i, user.Name, email))
+// FastSearchQuery ищет пользователей по произвольному условию
+func FastSearchQuery(out io.Writer, q Query) {
+	if err := (&Searcher{}).SearchFile(filePath, out, q); err != nil {
+		panic(err)
 	}
+}
 
-	if err := scanner.Err(); err != nil {
+// FastSearchParallel то же, что FastSearch, но файл разбирается на всех ядрах
+func FastSearchParallel(out io.Writer) {
+	s := &Searcher{Workers: runtime.GOMAXPROCS(0)}
+	if err := s.SearchFile(filePath, out, androidAndMSIE); err != nil {
 		panic(err)
 	}
-
-	fmt.Fprintln(out, "\nTotal unique browsers", len(seenBrowsers))
 }
 
+var (
+	serveAddr = flag.String("serve", "", "вместо вывода FastSearch поднять http-поиск по data/users.txt на этом адресе")
+	maxScans  = flag.Int("max-scans", 4, "сколько поисков http-сервер ведёт одновременно")
+)
+
 func main() {
+	flag.Parse()
+	if *serveAddr != "" {
+		srv := NewServer(filePath, Searcher{Workers: runtime.GOMAXPROCS(0)}, *maxScans)
+		log.Fatal(http.ListenAndServe(*serveAddr, srv))
+	}
+
 	FastSearch(ioutil.Discard)
 
 	fastOut := new(bytes.Buffer)
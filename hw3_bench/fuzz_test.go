@@ -0,0 +1,159 @@
+//go:build go1.18
+// +build go1.18
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/moguchev/coursera_go/hw3_bench/datagen"
+)
+
+// go test -fuzz FuzzSearchRecord
+// упавшие входы go test сам сохраняет в testdata/fuzz, дальше они проверяются обычным go test
+
+// slowSearch SlowSearch над data. ok == false - SlowSearch упал, такие входы он не умеет
+func slowSearch(data []byte) (out string, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	buf := new(bytes.Buffer)
+	SlowSearchReader(bytes.NewReader(data), buf)
+	return buf.String(), true
+}
+
+// fastSearch FastSearch последовательно и параллельно, результаты обязаны совпадать
+func fastSearch(t *testing.T, data []byte) (string, error) {
+	outs := []string{}
+	var errs []error
+	for _, workers := range []int{0, 3} {
+		out := new(bytes.Buffer)
+		err := (&Searcher{Workers: workers}).Search(bytes.NewReader(data), out, androidAndMSIE)
+		outs, errs = append(outs, out.String()), append(errs, err)
+	}
+	if (errs[0] == nil) != (errs[1] == nil) || errs[0] == nil && outs[0] != outs[1] {
+		t.Fatalf("sequential and parallel differ\n%v %q\n%v %q", errs[0], outs[0], errs[1], outs[1])
+	}
+	return outs[0], errs[0]
+}
+
+// encodeString json-строка. escapeAll - все ascii буквы как \u00XX, raw - без замены
+// невалидного utf-8, как его мог бы записать кто-то кроме encoding/json
+func encodeString(s string, escapeAll, raw bool) string {
+	if !escapeAll && !raw {
+		data, _ := json.Marshal(s)
+		return string(data)
+	}
+	buf := strings.Builder{}
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c < 0x20 || escapeAll && (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'):
+			buf.WriteString(`\u00`)
+			buf.WriteByte("0123456789abcdef"[c>>4])
+			buf.WriteByte("0123456789abcdef"[c&0xf])
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+const fuzzSecondLine = `{"browsers":["Mozilla/5.0 (Linux; Android 4.4.2)","Mozilla/4.0 (compatible; MSIE 8.0)"],"email":"x@y.z","name":"second"}`
+
+// FuzzSearchRecord пользователи с нормальными строковыми name и email: вывод должен совпадать байт в байт
+func FuzzSearchRecord(f *testing.F) {
+	f.Add("Sharon", "a@b.c", "Mozilla/5.0 (Linux; Android 4.4.2)", "MSIE 8.0", uint8(0))
+	f.Add("Jo\"hn\\", "a@@b@c", "Android", "MSIE", uint8(1))
+	f.Add("Иван", "i@x.ru", "Android MSIE", "", uint8(2))
+	f.Add("bad\xffutf8", "e@f", "Android\xfe", "MSIE\xff", uint8(6))
+
+	f.Fuzz(func(t *testing.T, name, email, browser1, browser2 string, flags uint8) {
+		escapeAll, raw := flags&1 != 0, flags&2 != 0
+		browsers := encodeString(browser1, escapeAll, raw) + "," + encodeString(browser2, escapeAll, raw)
+		if flags&4 != 0 {
+			browsers += `,1,null,{"a":["Android"]},["MSIE"]`
+		}
+		line := `{"browsers":[` + browsers + `],"email":` + encodeString(email, escapeAll, raw) +
+			`,"name":` + encodeString(name, escapeAll, raw) + `}`
+		data := []byte(line + "\n" + fuzzSecondLine)
+
+		expected, ok := slowSearch(data)
+		if !ok {
+			t.Skip()
+		}
+		got, err := fastSearch(t, data)
+		if err != nil {
+			t.Fatalf("FastSearch failed on valid data: %s\n%s", err, data)
+		}
+		if got != expected {
+			t.Fatalf("results not match\nGot:\n%v\nExpected:\n%v\nData:\n%q", got, expected, data)
+		}
+	})
+}
+
+var foundLine = regexp.MustCompile(`(?m)^\[\d+\] `)
+
+// summary номера найденных строк и число браузеров: name и email, которые не строки,
+// SlowSearch печатает как %!s(...), с этим сравнивать бессмысленно
+func summary(out string) string {
+	idx := strings.LastIndex(out, "Total unique browsers")
+	if idx < 0 {
+		return out
+	}
+	return strings.Join(foundLine.FindAllString(out, -1), "") + out[idx:]
+}
+
+// FuzzSearchLines произвольный вход: FastSearch не паникует, а там, где SlowSearch справился,
+// находит те же строки и столько же браузеров
+func FuzzSearchLines(f *testing.F) {
+	g := datagen.New(datagen.Config{Seed: 1, Adversarial: 1, Browsers: 3})
+	for i := 0; i < 20; i++ {
+		line := g.Line(nil)
+		if len(line) < 4<<10 {
+			f.Add(line)
+		}
+	}
+	f.Add([]byte(`null`))
+	f.Add([]byte(`{"browsers":["Android"],"browsers":["MSIE"],"email":"a@b","name":"dup"}`))
+	f.Add([]byte(`{"browsers":"Android MSIE","email":"a@b"}` + "\r\n" + fuzzSecondLine))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		got, err := fastSearch(t, data)
+		expected, ok := slowSearch(data)
+		if !ok {
+			return
+		}
+		if err != nil {
+			t.Fatalf("FastSearch failed where SlowSearch did not: %s\n%q", err, data)
+		}
+		if summary(got) != summary(expected) {
+			t.Fatalf("results not match\nGot:\n%v\nExpected:\n%v\nData:\n%q", got, expected, data)
+		}
+	})
+}
+
+func TestEncodeString(t *testing.T) {
+	for _, s := range []string{"", "Android", "a\"b\\c\n", "Иван 😀"} {
+		for flags := 0; flags < 4; flags++ {
+			decoded := ""
+			if err := json.Unmarshal([]byte(encodeString(s, flags&1 != 0, flags&2 != 0)), &decoded); err != nil || decoded != s {
+				t.Errorf("%q flags %d: got %q %v", s, flags, decoded, err)
+			}
+		}
+	}
+	if utf8.ValidString(encodeString("\xff", false, true)) {
+		t.Error("raw mode must keep invalid utf-8")
+	}
+}
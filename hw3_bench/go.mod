@@ -2,4 +2,4 @@ module github.com/moguchev/coursera_go/hw3_bench
 
 go 1.15
 
-require github.com/mailru/easyjson v0.7.6
+require github.com/klauspost/compress v1.13.6
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// IndexSuffix индекс лежит рядом с исходным файлом: users.txt -> users.txt.idx
+const IndexSuffix = ".idx"
+
+const indexMagic = "UIDX1\n"
+
+var (
+	// ErrIndexStale исходный файл изменился после построения индекса
+	ErrIndexStale   = errors.New("index is stale")
+	errIndexCorrupt = errors.New("index is corrupt")
+)
+
+// Index обратный индекс по браузерам: токен -> номера строк, где он встречается.
+// Токен - непрерывный кусок из букв, цифр и не-ascii байт внутри одного браузера.
+// Запросы Contains/Equals по браузерам превращаются в объединение/пересечение списков строк,
+// разбираются только строки-кандидаты
+type Index struct {
+	path    string
+	size    int64
+	modTime int64
+	// offsets начало каждой строки, последний элемент - размер файла
+	offsets []int64
+	// tokens списки строк в сжатом виде: количество и разности соседних номеров в uvarint
+	tokens map[string][]byte
+}
+
+// OpenIndex загружает индекс для файла path и перестраивает его, если индекса нет,
+// он испорчен или файл изменился
+func OpenIndex(path string) (*Index, error) {
+	ix, err := LoadIndex(path)
+	if err == nil {
+		return ix, nil
+	}
+	if !os.IsNotExist(err) && err != ErrIndexStale && err != errIndexCorrupt {
+		return nil, err
+	}
+	return BuildIndex(path)
+}
+
+// LoadIndex загружает индекс для файла path, ErrIndexStale - если файл изменился
+func LoadIndex(path string) (*Index, error) {
+	data, err := ioutil.ReadFile(path + IndexSuffix)
+	if err != nil {
+		return nil, err
+	}
+	ix, err := decodeIndex(path, data)
+	if err != nil {
+		return nil, err
+	}
+	if stale, err := ix.stale(); err != nil {
+		return nil, err
+	} else if stale {
+		return nil, ErrIndexStale
+	}
+	return ix, nil
+}
+
+// BuildIndex разбирает файл path и записывает индекс рядом с ним
+func BuildIndex(path string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	src, err := openSource(file)
+	if err != nil {
+		return nil, err
+	}
+	defer src.release()
+
+	ix := &Index{path: path, size: info.Size(), modTime: info.ModTime().UnixNano()}
+	lines := map[string][]uint32{}
+	view := userView{}
+	end, err := src.scanLines(func(n int, pos int64, line []byte) error {
+		ix.offsets = append(ix.offsets, pos)
+		if err := view.scan(line); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		for _, browser := range view.Browsers {
+			for _, token := range tokenize(browser) {
+				list := lines[string(token)]
+				if len(list) == 0 || list[len(list)-1] != uint32(n) {
+					lines[string(token)] = append(list, uint32(n))
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ix.offsets = append(ix.offsets, end)
+
+	ix.tokens = make(map[string][]byte, len(lines))
+	for token, list := range lines {
+		ix.tokens[token] = encodePostings(list)
+	}
+
+	if err := ix.write(); err != nil {
+		return nil, err
+	}
+	return ix, nil
+}
+
+// Search то же, что Searcher.SearchFile, но разбирает только строки, которые могут подойти.
+// Если файл изменился, индекс сначала перестраивается
+func (ix *Index) Search(out io.Writer, q Query) error {
+	return ix.SearchOutput(out, q, Output{})
+}
+
+// SearchOutput то же, что Search, но пишет результат в формате o
+func (ix *Index) SearchOutput(out io.Writer, q Query, o Output) error {
+	if stale, err := ix.stale(); err != nil {
+		return err
+	} else if stale {
+		fresh, err := BuildIndex(ix.path)
+		if err != nil {
+			return err
+		}
+		*ix = *fresh
+	}
+
+	file, err := os.Open(ix.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	src, err := openSource(file)
+	if err != nil {
+		return err
+	}
+	defer src.release()
+
+	// нужны и строки под запрос, и строки с браузерами для "Total unique browsers"
+	lines, ok := q.candidates(ix)
+	for _, t := range q.browserTerms() {
+		termLines, termOk := t.candidates(ix)
+		ok = ok && termOk
+		lines = unionLines(lines, termLines)
+	}
+	if !ok {
+		s := &Searcher{Output: o}
+		if src.data == nil {
+			return s.searchStream(context.Background(), src.r, out, q)
+		}
+		return s.searchBytes(context.Background(), src.data, out, q)
+	}
+	if len(lines) > 0 && int(lines[len(lines)-1]) >= ix.Lines() {
+		return errIndexCorrupt
+	}
+
+	seenBrowsers := mapSet{}
+	m := newLineMatcher(q, UniqueRaw)
+
+	w := newOutWriter(out, o)
+	if err := w.header(); err != nil {
+		return err
+	}
+
+	visit := func(n int, line []byte) error {
+		match, err := m.match(line, seenBrowsers)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		if !match {
+			return nil
+		}
+		return w.user(n, &m.view)
+	}
+	if src.data != nil {
+		for _, n := range lines {
+			if err := visit(int(n), trimLine(src.data[ix.offsets[n]:ix.offsets[n+1]])); err != nil {
+				return err
+			}
+		}
+	} else {
+		// сжатый файл читается подряд, кандидаты отсортированы по номеру строки
+		_, err := src.scanLines(func(n int, _ int64, line []byte) error {
+			if len(lines) == 0 {
+				return io.EOF
+			}
+			if int(lines[0]) != n {
+				return nil
+			}
+			lines = lines[1:]
+			return visit(n, line)
+		})
+		if err != nil {
+			return err
+		}
+		if len(lines) > 0 {
+			return errIndexCorrupt
+		}
+	}
+
+	return w.footer(seenBrowsers.len(), nil)
+}
+
+// Lines сколько строк в проиндексированном файле
+func (ix *Index) Lines() int {
+	return len(ix.offsets) - 1
+}
+
+func (ix *Index) stale() (bool, error) {
+	info, err := os.Stat(ix.path)
+	if err != nil {
+		return false, err
+	}
+	return info.Size() != ix.size || info.ModTime().UnixNano() != ix.modTime, nil
+}
+
+// lines список строк токена, nil если токена нет
+func (ix *Index) lines(token string) []uint32 {
+	return decodePostings(ix.tokens[token])
+}
+
+// linesContaining объединение списков всех токенов, в которые входит substr
+func (ix *Index) linesContaining(substr string) []uint32 {
+	var lines []uint32
+	for token, postings := range ix.tokens {
+		if strings.Contains(token, substr) {
+			lines = unionLines(lines, decodePostings(postings))
+		}
+	}
+	return lines
+}
+
+// write формат: magic, размер и время изменения файла, разности начал строк,
+// затем токены в порядке сортировки: длина, токен, длина списка, список. Всё в uvarint
+func (ix *Index) write() error {
+	buf := []byte(indexMagic)
+	buf = appendUvarint(buf, uint64(ix.size))
+	buf = appendVarint(buf, ix.modTime)
+	buf = appendUvarint(buf, uint64(len(ix.offsets)))
+	prev := int64(0)
+	for _, off := range ix.offsets {
+		buf = appendUvarint(buf, uint64(off-prev))
+		prev = off
+	}
+
+	tokens := make([]string, 0, len(ix.tokens))
+	for token := range ix.tokens {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	buf = appendUvarint(buf, uint64(len(tokens)))
+	for _, token := range tokens {
+		buf = appendUvarint(buf, uint64(len(token)))
+		buf = append(buf, token...)
+		buf = appendUvarint(buf, uint64(len(ix.tokens[token])))
+		buf = append(buf, ix.tokens[token]...)
+	}
+
+	// через временный файл, чтобы читатель не увидел недописанный индекс
+	tmp := ix.path + IndexSuffix + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ix.path+IndexSuffix)
+}
+
+func decodeIndex(path string, data []byte) (*Index, error) {
+	if !bytes.HasPrefix(data, []byte(indexMagic)) {
+		return nil, errIndexCorrupt
+	}
+	d := decoder{data: data[len(indexMagic):]}
+	ix := &Index{path: path}
+	ix.size = int64(d.uvarint())
+	ix.modTime = d.varint()
+
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		return nil, errIndexCorrupt
+	}
+	ix.offsets = make([]int64, n)
+	prev := int64(0)
+	for i := range ix.offsets {
+		prev += int64(d.uvarint())
+		ix.offsets[i] = prev
+	}
+	if n == 0 || ix.offsets[n-1] != ix.size {
+		return nil, errIndexCorrupt
+	}
+
+	n = d.uvarint()
+	if n > uint64(len(d.data)) {
+		return nil, errIndexCorrupt
+	}
+	ix.tokens = make(map[string][]byte, n)
+	for i := uint64(0); i < n; i++ {
+		token := d.bytes(d.uvarint())
+		ix.tokens[string(token)] = d.bytes(d.uvarint())
+	}
+
+	if d.err || len(d.data) != 0 {
+		return nil, errIndexCorrupt
+	}
+	return ix, nil
+}
+
+// decoder читает uvarint подряд, после первой ошибки все чтения возвращают нули
+type decoder struct {
+	data []byte
+	err  bool
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err, d.data = true, nil
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err, d.data = true, nil
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) bytes(n uint64) []byte {
+	if n > uint64(len(d.data)) {
+		d.err, d.data = true, nil
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func encodePostings(lines []uint32) []byte {
+	buf := appendUvarint(nil, uint64(len(lines)))
+	prev := uint32(0)
+	for _, n := range lines {
+		buf = appendUvarint(buf, uint64(n-prev))
+		prev = n
+	}
+	return buf
+}
+
+func decodePostings(buf []byte) []uint32 {
+	if len(buf) == 0 {
+		return nil
+	}
+	d := decoder{data: buf}
+	n := d.uvarint()
+	if n > uint64(len(buf)) {
+		n = uint64(len(buf))
+	}
+	lines := make([]uint32, 0, n)
+	prev := uint32(0)
+	for len(d.data) > 0 && !d.err {
+		prev += uint32(d.uvarint())
+		lines = append(lines, prev)
+	}
+	return lines
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutVarint(tmp[:], v)]...)
+}
+
+func unionLines(a, b []uint32) []uint32 {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+	res := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			res = append(res, a[i])
+			i++
+		case a[i] > b[j]:
+			res = append(res, b[j])
+			j++
+		default:
+			res = append(res, a[i])
+			i, j = i+1, j+1
+		}
+	}
+	res = append(res, a[i:]...)
+	return append(res, b[j:]...)
+}
+
+func intersectLines(a, b []uint32) []uint32 {
+	res := []uint32{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			res = append(res, a[i])
+			i, j = i+1, j+1
+		}
+	}
+	return res
+}
+
+func isTokenByte(c byte) bool {
+	return c >= 0x80 || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// tokenize режет браузер на токены, срезы смотрят в browser
+func tokenize(browser []byte) [][]byte {
+	tokens := [][]byte{}
+	start := -1
+	for i, c := range browser {
+		switch {
+		case isTokenByte(c) && start < 0:
+			start = i
+		case !isTokenByte(c) && start >= 0:
+			tokens = append(tokens, browser[start:i])
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, browser[start:])
+	}
+	return tokens
+}
+
+// indexable подстрока из одних символов токена целиком лежит внутри одного токена
+func indexable(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTokenByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// source исходный файл индекса. Несжатый отображается в память целиком и читается по смещениям
+// из индекса, сжатый распаковывается на лету (r) и целиком в памяти не лежит,
+// смещения в индексе тогда считаются по распакованным данным
+type source struct {
+	data    []byte
+	r       io.Reader
+	release func()
+}
+
+func openSource(file *os.File) (*source, error) {
+	data, unmap, err := mmapFile(file)
+	if err != nil {
+		// без mmap сжатие видно по первым байтам потока
+		br := bufio.NewReaderSize(file, 64<<10)
+		head, _ := br.Peek(len(zstdMagic))
+		if DetectCompression(head) == CompressionNone {
+			data, err := ioutil.ReadAll(br)
+			return &source{data: data, release: func() {}}, err
+		}
+		return openCompressed(br, func() {})
+	}
+	if DetectCompression(data) == CompressionNone {
+		return &source{data: data, release: func() { unmap() }}, nil
+	}
+	return openCompressed(bytes.NewReader(data), func() { unmap() })
+}
+
+func openCompressed(r io.Reader, release func()) (*source, error) {
+	zr, closeDecoder, err := decompress(r, runtime.GOMAXPROCS(0))
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &source{r: zr, release: func() {
+		closeDecoder()
+		release()
+	}}, nil
+}
+
+// scanLines вызывает fn для каждой строки: номер, смещение начала и строка без перевода строки.
+// Строка годится только до возврата из fn. fn вернул io.EOF - чтение прекращается без ошибки.
+// end - размер прочитанных данных
+func (src *source) scanLines(fn func(n int, pos int64, line []byte) error) (end int64, err error) {
+	r := src.r
+	if src.data != nil {
+		r = bytes.NewReader(src.data)
+	}
+	reader := bufio.NewReaderSize(r, 64<<10)
+	long := []byte{}
+	for n := 0; ; n++ {
+		line, err := readRawLine(reader, &long)
+		if err == io.EOF {
+			return end, nil
+		}
+		if err != nil {
+			return end, err
+		}
+		if err := fn(n, end, trimLine(line)); err == io.EOF {
+			return end, nil
+		} else if err != nil {
+			return end, err
+		}
+		end += int64(len(line))
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func copyUsers(t *testing.T) string {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "users.txt")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func indexQueries(t *testing.T) map[string]Query {
+	return map[string]Query{
+		"android and msie": androidAndMSIE,
+		"or":               Or(Contains(FieldBrowser, "Chrome"), Equals(FieldBrowser, "Opera/9.80 (X11; Linux i686; U; ru) Presto/2.8.131 Version/11.11")),
+		"mixed":            And(Contains(FieldBrowser, "Safari"), Contains(FieldCountry, "a")),
+		"no browser terms": Contains(FieldCompany, "Tech"),
+		"not indexable":    Contains(FieldBrowser, "MSIE 8"),
+		"regexp":           mustRegexp(t, FieldBrowser, `^Mozilla/5\.0 \(Windows`),
+		"not":              And(Contains(FieldBrowser, "Android"), Not(Contains(FieldBrowser, "Opera"))),
+		"missing token":    Contains(FieldBrowser, "NoSuchBrowser"),
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	path := copyUsers(t)
+	ix, err := OpenIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, q := range indexQueries(t) {
+		expected := new(bytes.Buffer)
+		if err := (&Searcher{}).SearchFile(path, expected, q); err != nil {
+			t.Fatal(err)
+		}
+		got := new(bytes.Buffer)
+		if err := ix.Search(got, q); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != expected.String() {
+			t.Errorf("[%s] results not match\nGot:\n%v\nExpected:\n%v", name, got, expected)
+		}
+	}
+
+	// второй раз индекс читается с диска
+	loaded, err := LoadIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Lines() != ix.Lines() || len(loaded.tokens) != len(ix.tokens) {
+		t.Errorf("loaded index differs: %d lines, %d tokens", loaded.Lines(), len(loaded.tokens))
+	}
+}
+
+func TestIndexCandidates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	input := `{"browsers":["Mozilla (Android 4.1)","MSIE 9"]}` + "\n" +
+		`{"browsers":["Opera/9.80"]}` + "\n" +
+		`{"browsers":["Androidish","xMSIEx"]}` + "\n" +
+		`{}`
+	if err := ioutil.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := BuildIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		q     Query
+		lines []uint32
+		ok    bool
+	}{
+		{androidAndMSIE, []uint32{0, 2}, true},
+		{Or(Contains(FieldBrowser, "Opera"), Contains(FieldBrowser, "MSIE")), []uint32{0, 1, 2}, true},
+		{Equals(FieldBrowser, "Opera/9.80"), []uint32{1}, true},
+		{Contains(FieldBrowser, "Opera/9"), nil, false},
+		{Not(Contains(FieldBrowser, "Opera")), nil, false},
+		{And(Contains(FieldCountry, "x"), Contains(FieldBrowser, "Opera")), []uint32{1}, true},
+		{Or(Contains(FieldCountry, "x"), Contains(FieldBrowser, "Opera")), nil, false},
+	}
+	for i, c := range cases {
+		lines, ok := c.q.candidates(ix)
+		if ok != c.ok || ok && !equalLines(lines, c.lines) {
+			t.Errorf("[%d] expected %v %v, got %v %v", i, c.lines, c.ok, lines, ok)
+		}
+	}
+}
+
+func equalLines(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIndexInvalidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	first := `{"browsers":["MSIE Android"],"email":"a@b","name":"first"}` + "\n"
+	if err := ioutil.WriteFile(path, []byte(first), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := OpenIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := first + `{"browsers":["MSIE Android 2"],"email":"c@d","name":"second"}` + "\n"
+	if err := ioutil.WriteFile(path, []byte(second), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// размер тот же, поменялось только время
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadIndex(path); err != ErrIndexStale {
+		t.Fatalf("expected ErrIndexStale, got %v", err)
+	}
+
+	out := new(bytes.Buffer)
+	if err := ix.Search(out, androidAndMSIE); err != nil {
+		t.Fatal(err)
+	}
+	expected := "found users:\n[0] first <a [at] b>\n[1] second <c [at] d>\n\nTotal unique browsers 2\n"
+	if out.String() != expected {
+		t.Errorf("expected rebuilt index, got\n%q", out.String())
+	}
+	if _, err := LoadIndex(path); err != nil {
+		t.Errorf("rebuilt index must be saved, got %v", err)
+	}
+
+	// испорченный индекс перестраивается
+	if err := ioutil.WriteFile(path+IndexSuffix, []byte(indexMagic+"\xff"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadIndex(path); err != errIndexCorrupt {
+		t.Errorf("expected errIndexCorrupt, got %v", err)
+	}
+	if ix, err = OpenIndex(path); err != nil || ix.Lines() != 2 {
+		t.Errorf("expected rebuilt index with 2 lines, got %v", err)
+	}
+}
+
+func BenchmarkIndexSearch(b *testing.B) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.txt")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		b.Fatal(err)
+	}
+	ix, err := OpenIndex(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ix.Search(ioutil.Discard, androidAndMSIE); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Package example структуры, на которых проверяется json_gen: всё, что он умеет
+package example
+
+//go:generate go run .. example.go example_json.go
+
+// Level именованный тип на основе встроенного
+type Level int8
+
+// jsongen: json
+type Profile struct {
+	ID       int64     `json:"id"`
+	Login    string    `json:"login"`
+	Score    float64   `json:"score,omitempty"`
+	Ratio    float32   `json:"ratio"`
+	Active   bool      `json:"active,omitempty"`
+	Level    Level     `json:"level"`
+	Tags     []string  `json:"tags,omitempty"`
+	Address  Address   `json:"address"`
+	Previous []Address `json:"previous"`
+	Boss     *Profile  `json:"boss,omitempty"`
+	Matrix   [][]uint16
+	Secret   string `json:"-"`
+	internal int
+}
+
+// Address вложенная структура без пометки: для неё генерируются только функции разбора и записи
+type Address struct {
+	City  string  `json:"city,omitempty"`
+	Zip   *uint32 `json:"zip"`
+	Lines []string
+}
+
+// Event разбирается, но не пишется; незнакомые поля пропускаются без проверки
+//
+// jsongen: json decode
+type Event struct {
+	Kind    string   `json:"kind"`
+	Profile *Profile `json:"profile"`
+}
@@ -0,0 +1,326 @@
+// Code generated by json_gen. DO NOT EDIT.
+
+package example
+
+import "github.com/moguchev/coursera_go/hw3_bench/jsonrt"
+
+// UnmarshalJSON реализует json.Unmarshaler
+func (out *Profile) UnmarshalJSON(data []byte) error {
+	l := jsonrt.Lexer{Data: data, FastSkip: false}
+	jsonDecodeProfile(&l, out)
+	l.End()
+	return l.Error()
+}
+
+// MarshalJSON реализует json.Marshaler
+func (in Profile) MarshalJSON() ([]byte, error) {
+	w := jsonrt.Writer{}
+	jsonEncodeProfile(&w, &in)
+	return w.Buf, nil
+}
+
+// UnmarshalJSON реализует json.Unmarshaler
+func (out *Event) UnmarshalJSON(data []byte) error {
+	l := jsonrt.Lexer{Data: data, FastSkip: true}
+	jsonDecodeEvent(&l, out)
+	l.End()
+	return l.Error()
+}
+
+func jsonDecodeProfile(l *jsonrt.Lexer, out *Profile) {
+	if l.Null() {
+		return
+	}
+	l.Delim('{')
+	for l.More('}') {
+		switch string(l.Key()) {
+		case "id":
+			if !l.Null() {
+				out.ID = l.Int64(64)
+			}
+		case "login":
+			if !l.Null() {
+				out.Login = l.String()
+			}
+		case "score":
+			if !l.Null() {
+				out.Score = l.Float64(64)
+			}
+		case "ratio":
+			if !l.Null() {
+				out.Ratio = float32(l.Float64(32))
+			}
+		case "active":
+			if !l.Null() {
+				out.Active = l.Bool()
+			}
+		case "level":
+			if !l.Null() {
+				out.Level = Level(l.Int64(8))
+			}
+		case "tags":
+			if l.Null() {
+				out.Tags = nil
+			} else {
+				s0 := out.Tags[:0]
+				if s0 == nil {
+					s0 = []string{}
+				}
+				l.Delim('[')
+				for l.More(']') {
+					var v0 string
+					if !l.Null() {
+						v0 = l.String()
+					}
+					s0 = append(s0, v0)
+				}
+				out.Tags = s0
+			}
+		case "address":
+			jsonDecodeAddress(l, &out.Address)
+		case "previous":
+			if l.Null() {
+				out.Previous = nil
+			} else {
+				s0 := out.Previous[:0]
+				if s0 == nil {
+					s0 = []Address{}
+				}
+				l.Delim('[')
+				for l.More(']') {
+					var v0 Address
+					jsonDecodeAddress(l, &v0)
+					s0 = append(s0, v0)
+				}
+				out.Previous = s0
+			}
+		case "boss":
+			if l.Null() {
+				out.Boss = nil
+			} else {
+				if out.Boss == nil {
+					out.Boss = new(Profile)
+				}
+				jsonDecodeProfile(l, out.Boss)
+			}
+		case "Matrix":
+			if l.Null() {
+				out.Matrix = nil
+			} else {
+				s0 := out.Matrix[:0]
+				if s0 == nil {
+					s0 = [][]uint16{}
+				}
+				l.Delim('[')
+				for l.More(']') {
+					var v0 []uint16
+					if l.Null() {
+						v0 = nil
+					} else {
+						s1 := v0[:0]
+						if s1 == nil {
+							s1 = []uint16{}
+						}
+						l.Delim('[')
+						for l.More(']') {
+							var v1 uint16
+							if !l.Null() {
+								v1 = uint16(l.Uint64(16))
+							}
+							s1 = append(s1, v1)
+						}
+						v0 = s1
+					}
+					s0 = append(s0, v0)
+				}
+				out.Matrix = s0
+			}
+		default:
+			l.Skip()
+		}
+	}
+}
+
+func jsonEncodeProfile(w *jsonrt.Writer, in *Profile) {
+	w.RawByte('{')
+	w.RawString("\"id\":")
+	w.Int64(in.ID)
+	w.RawString(",\"login\":")
+	w.String(in.Login)
+	if in.Score != 0 {
+		w.RawString(",\"score\":")
+		w.Float64(in.Score, 64)
+	}
+	w.RawString(",\"ratio\":")
+	w.Float64(float64(in.Ratio), 32)
+	if in.Active {
+		w.RawString(",\"active\":")
+		w.Bool(in.Active)
+	}
+	w.RawString(",\"level\":")
+	w.Int64(int64(in.Level))
+	if len(in.Tags) != 0 {
+		w.RawString(",\"tags\":")
+		if in.Tags == nil {
+			w.RawString("null")
+		} else {
+			w.RawByte('[')
+			for i0 := range in.Tags {
+				if i0 > 0 {
+					w.RawByte(',')
+				}
+				w.String(in.Tags[i0])
+			}
+			w.RawByte(']')
+		}
+	}
+	w.RawString(",\"address\":")
+	jsonEncodeAddress(w, &in.Address)
+	w.RawString(",\"previous\":")
+	if in.Previous == nil {
+		w.RawString("null")
+	} else {
+		w.RawByte('[')
+		for i0 := range in.Previous {
+			if i0 > 0 {
+				w.RawByte(',')
+			}
+			jsonEncodeAddress(w, &in.Previous[i0])
+		}
+		w.RawByte(']')
+	}
+	if in.Boss != nil {
+		w.RawString(",\"boss\":")
+		if in.Boss == nil {
+			w.RawString("null")
+		} else {
+			jsonEncodeProfile(w, in.Boss)
+		}
+	}
+	w.RawString(",\"Matrix\":")
+	if in.Matrix == nil {
+		w.RawString("null")
+	} else {
+		w.RawByte('[')
+		for i0 := range in.Matrix {
+			if i0 > 0 {
+				w.RawByte(',')
+			}
+			if in.Matrix[i0] == nil {
+				w.RawString("null")
+			} else {
+				w.RawByte('[')
+				for i1 := range in.Matrix[i0] {
+					if i1 > 0 {
+						w.RawByte(',')
+					}
+					w.Uint64(uint64(in.Matrix[i0][i1]))
+				}
+				w.RawByte(']')
+			}
+		}
+		w.RawByte(']')
+	}
+	w.RawByte('}')
+}
+
+func jsonDecodeEvent(l *jsonrt.Lexer, out *Event) {
+	if l.Null() {
+		return
+	}
+	l.Delim('{')
+	for l.More('}') {
+		switch string(l.Key()) {
+		case "kind":
+			if !l.Null() {
+				out.Kind = l.String()
+			}
+		case "profile":
+			if l.Null() {
+				out.Profile = nil
+			} else {
+				if out.Profile == nil {
+					out.Profile = new(Profile)
+				}
+				jsonDecodeProfile(l, out.Profile)
+			}
+		default:
+			l.Skip()
+		}
+	}
+}
+
+func jsonDecodeAddress(l *jsonrt.Lexer, out *Address) {
+	if l.Null() {
+		return
+	}
+	l.Delim('{')
+	for l.More('}') {
+		switch string(l.Key()) {
+		case "city":
+			if !l.Null() {
+				out.City = l.String()
+			}
+		case "zip":
+			if l.Null() {
+				out.Zip = nil
+			} else {
+				if out.Zip == nil {
+					out.Zip = new(uint32)
+				}
+				if !l.Null() {
+					*out.Zip = uint32(l.Uint64(32))
+				}
+			}
+		case "Lines":
+			if l.Null() {
+				out.Lines = nil
+			} else {
+				s0 := out.Lines[:0]
+				if s0 == nil {
+					s0 = []string{}
+				}
+				l.Delim('[')
+				for l.More(']') {
+					var v0 string
+					if !l.Null() {
+						v0 = l.String()
+					}
+					s0 = append(s0, v0)
+				}
+				out.Lines = s0
+			}
+		default:
+			l.Skip()
+		}
+	}
+}
+
+func jsonEncodeAddress(w *jsonrt.Writer, in *Address) {
+	w.RawByte('{')
+	if in.City != "" {
+		w.RawString("\"city\":")
+		w.String(in.City)
+	}
+	w.Comma()
+	w.RawString("\"zip\":")
+	if in.Zip == nil {
+		w.RawString("null")
+	} else {
+		w.Uint64(uint64(*in.Zip))
+	}
+	w.RawString(",\"Lines\":")
+	if in.Lines == nil {
+		w.RawString("null")
+	} else {
+		w.RawByte('[')
+		for i0 := range in.Lines {
+			if i0 > 0 {
+				w.RawByte(',')
+			}
+			w.String(in.Lines[i0])
+		}
+		w.RawByte(']')
+	}
+	w.RawByte('}')
+}
@@ -0,0 +1,120 @@
+package example
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// plainProfile Profile без сгенерированных методов: эталон - encoding/json
+type plainProfile Profile
+
+func sampleProfile() Profile {
+	zip := uint32(123456)
+	return Profile{
+		ID: -42, Login: "jo\"hn <admin>", Score: 0.1, Ratio: 1.5, Active: true, Level: -3,
+		Tags:     []string{"a", "", " "},
+		Address:  Address{City: "Moscow", Zip: &zip, Lines: []string{"Red square", "1"}},
+		Previous: []Address{{}, {Lines: []string{}}},
+		Boss:     &Profile{Login: "boss", Previous: []Address{}},
+		Matrix:   [][]uint16{{1, 2}, nil, {}},
+		Secret:   "hidden",
+		internal: 1,
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	for i, p := range []Profile{{}, sampleProfile()} {
+		got, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := json.Marshal(plainProfile(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(expected) {
+			t.Errorf("[%d] got\n%s\nexpected\n%s", i, got, expected)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	full, _ := json.Marshal(plainProfile(sampleProfile()))
+	cases := []string{
+		string(full),
+		`{}`,
+		`null`,
+		`{"id":null,"login":null,"tags":null,"address":null,"boss":null,"previous":null,"Matrix":[[1],null]}`,
+		` { "login" : "x\\yA" , "unknown" : {"a":[1,2,{"b":null}]}, "level": 127, "ratio": 1e-3 } `,
+		`{"tags":[],"previous":[{"zip":null,"city":"c"}],"boss":{"boss":{"login":"top"}}}`,
+	}
+	for i, c := range cases {
+		expected := plainProfile{}
+		if err := json.Unmarshal([]byte(c), &expected); err != nil {
+			t.Fatalf("[%d] bad test data: %s", i, err)
+		}
+		got := Profile{}
+		if err := got.UnmarshalJSON([]byte(c)); err != nil {
+			t.Fatalf("[%d] %s", i, err)
+		}
+		if !reflect.DeepEqual(got, Profile(expected)) {
+			t.Errorf("[%d] got\n%#v\nexpected\n%#v", i, got, expected)
+		}
+	}
+
+	bad := []string{``, `[]`, `{"id":1.5}`, `{"level":128}`, `{"id":"1"}`, `{"tags":[1]}`, `{"login":"x"} {}`,
+		`{"unknown":[1,]}`, `{"Matrix":[[-1]]}`, `{"address":{"zip":-1}}`}
+	for _, c := range bad {
+		p := Profile{}
+		if err := p.UnmarshalJSON([]byte(c)); err == nil {
+			t.Errorf("%s: expected error", c)
+		}
+	}
+}
+
+func TestUnmarshalReuse(t *testing.T) {
+	p := Profile{Tags: make([]string, 0, 8), Login: "old"}
+	if err := p.UnmarshalJSON([]byte(`{"tags":["a","b"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if p.Login != "old" || len(p.Tags) != 2 || cap(p.Tags) != 8 {
+		t.Errorf("got %+v", p)
+	}
+}
+
+func TestDecodeOnly(t *testing.T) {
+	if _, ok := interface{}(Event{}).(json.Marshaler); ok {
+		t.Error("Event must not have MarshalJSON")
+	}
+	e := Event{}
+	data := `{"skip":{"a":["}",{"b":"\"]"}]},"kind":"login","more":[1,2,3],"profile":{"login":"x","x":{}},"n":-1.5}`
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Kind != "login" || e.Profile == nil || e.Profile.Login != "x" {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	data, _ := json.Marshal(plainProfile(sampleProfile()))
+	b.Run("generated", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p := Profile{}
+			if err := p.UnmarshalJSON(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("encoding/json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p := plainProfile{}
+			if err := json.Unmarshal(data, &p); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
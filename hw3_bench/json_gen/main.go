@@ -0,0 +1,482 @@
+// json_gen генерирует MarshalJSON и UnmarshalJSON без рефлексии для структур,
+// помеченных комментарием:
+//
+//	// jsongen: json
+//	type User struct { ... }
+//
+// "// jsongen: json decode" - только UnmarshalJSON, незнакомые поля пропускаются без проверки.
+// Поддерживаются теги json с omitempty и "-", строки, bool, числа, вложенные структуры
+// из того же файла, срезы и указатели. Ключи сравниваются точно: в отличие от encoding/json,
+// "Name" не совпадёт с тегом "name".
+//
+// go run ./json_gen models/models.go models/models_json.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const mark = "// jsongen:"
+
+func main() {
+	if len(os.Args) != 3 {
+		log.Fatalf("usage: %s <in.go> <out.go>", os.Args[0])
+	}
+	src, err := ioutil.ReadFile(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	code, err := generate(os.Args[1], src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(os.Args[2], code, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate код для помеченных структур файла filename с текстом src
+func generate(filename string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &gen{types: map[string]ast.Expr{}, done: map[string]bool{}}
+	type marked struct {
+		name   string
+		decode bool
+	}
+	roots := []marked{}
+	for _, decl := range node.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			g.types[ts.Name.Name] = ts.Type
+			doc := ts.Doc
+			if doc == nil && len(gd.Specs) == 1 {
+				doc = gd.Doc
+			}
+			opts, ok, err := parseMark(doc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", ts.Name.Name, err)
+			}
+			if !ok {
+				continue
+			}
+			if _, isStruct := ts.Type.(*ast.StructType); !isStruct {
+				return nil, fmt.Errorf("%s: only structs can be marked", ts.Name.Name)
+			}
+			roots = append(roots, marked{ts.Name.Name, opts == "decode"})
+		}
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("%s: no structs marked with %q", filename, mark+" json")
+	}
+
+	g.printf("// Code generated by json_gen. DO NOT EDIT.\n\n")
+	g.printf("package %s\n\n", node.Name.Name)
+	g.printf("import %q\n", "github.com/moguchev/coursera_go/hw3_bench/jsonrt")
+
+	for _, r := range roots {
+		g.printf("\n// UnmarshalJSON реализует json.Unmarshaler\n")
+		g.printf("func (out *%s) UnmarshalJSON(data []byte) error {\n", r.name)
+		g.printf("l := jsonrt.Lexer{Data: data, FastSkip: %v}\n", r.decode)
+		g.printf("%s(&l, out)\n", g.need(decodeFunc, r.name))
+		g.printf("l.End()\nreturn l.Error()\n}\n")
+		if r.decode {
+			continue
+		}
+		g.printf("\n// MarshalJSON реализует json.Marshaler\n")
+		g.printf("func (in %s) MarshalJSON() ([]byte, error) {\n", r.name)
+		g.printf("w := jsonrt.Writer{}\n")
+		g.printf("%s(&w, &in)\n", g.need(encodeFunc, r.name))
+		g.printf("return w.Buf, nil\n}\n")
+	}
+
+	for len(g.queue) > 0 {
+		fn := g.queue[0]
+		g.queue = g.queue[1:]
+		var err error
+		if strings.HasPrefix(fn, decodeFunc) {
+			err = g.decodeStruct(strings.TrimPrefix(fn, decodeFunc))
+		} else {
+			err = g.encodeStruct(strings.TrimPrefix(fn, encodeFunc))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return format.Source(g.out.Bytes())
+}
+
+// parseMark опции из комментария "// jsongen: json [decode]", ok - есть ли он вообще
+func parseMark(doc *ast.CommentGroup) (opts string, ok bool, err error) {
+	if doc == nil {
+		return "", false, nil
+	}
+	for _, c := range doc.List {
+		if !strings.HasPrefix(c.Text, mark) {
+			continue
+		}
+		words := strings.Fields(strings.TrimPrefix(c.Text, mark))
+		switch {
+		case len(words) == 1 && words[0] == "json":
+			return "", true, nil
+		case len(words) == 2 && words[0] == "json" && words[1] == "decode":
+			return "decode", true, nil
+		}
+		return "", false, fmt.Errorf("bad mark %q", c.Text)
+	}
+	return "", false, nil
+}
+
+const (
+	decodeFunc = "jsonDecode"
+	encodeFunc = "jsonEncode"
+)
+
+type gen struct {
+	out   bytes.Buffer
+	types map[string]ast.Expr
+	// done функции, которые уже сгенерированы или стоят в queue
+	done  map[string]bool
+	queue []string
+}
+
+func (g *gen) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.out, format, args...)
+}
+
+// need имя функции разбора или записи структуры name; сама функция сгенерируется позже
+func (g *gen) need(prefix, name string) string {
+	fn := prefix + name
+	if !g.done[fn] {
+		g.done[fn] = true
+		g.queue = append(g.queue, fn)
+	}
+	return fn
+}
+
+type field struct {
+	goName    string
+	key       string
+	omitempty bool
+	typ       ast.Expr
+}
+
+// fields поля структуры name, которые попадают в json, в порядке объявления
+func (g *gen) fields(name string) ([]field, error) {
+	st := g.types[name].(*ast.StructType)
+	res := []field{}
+	keys := map[string]bool{}
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded fields are not supported", name)
+		}
+		tag := ""
+		if f.Tag != nil {
+			unquoted, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(unquoted).Get("json")
+		}
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		omitempty := false
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "omitempty":
+				omitempty = true
+			default:
+				return nil, fmt.Errorf("%s: unsupported tag option %q", name, opt)
+			}
+		}
+		for _, ident := range f.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			key := parts[0]
+			if key == "" {
+				key = ident.Name
+			}
+			if keys[key] {
+				return nil, fmt.Errorf("%s: duplicate key %q", name, key)
+			}
+			keys[key] = true
+			res = append(res, field{goName: ident.Name, key: key, omitempty: omitempty, typ: f.Type})
+		}
+	}
+	return res, nil
+}
+
+// basicKinds имя встроенного типа -> как его читать и писать:
+// read возвращает ret, write принимает conv
+var basicKinds = map[string]struct {
+	read, ret, write, conv string
+}{
+	"string":  {"l.String()", "string", "w.String(%s)", "string"},
+	"bool":    {"l.Bool()", "bool", "w.Bool(%s)", "bool"},
+	"int":     {"l.Int()", "int", "w.Int64(%s)", "int64"},
+	"int8":    {"l.Int64(8)", "int64", "w.Int64(%s)", "int64"},
+	"int16":   {"l.Int64(16)", "int64", "w.Int64(%s)", "int64"},
+	"int32":   {"l.Int64(32)", "int64", "w.Int64(%s)", "int64"},
+	"rune":    {"l.Int64(32)", "int64", "w.Int64(%s)", "int64"},
+	"int64":   {"l.Int64(64)", "int64", "w.Int64(%s)", "int64"},
+	"uint":    {"l.Uint()", "uint", "w.Uint64(%s)", "uint64"},
+	"uint8":   {"l.Uint64(8)", "uint64", "w.Uint64(%s)", "uint64"},
+	"byte":    {"l.Uint64(8)", "uint64", "w.Uint64(%s)", "uint64"},
+	"uint16":  {"l.Uint64(16)", "uint64", "w.Uint64(%s)", "uint64"},
+	"uint32":  {"l.Uint64(32)", "uint64", "w.Uint64(%s)", "uint64"},
+	"uint64":  {"l.Uint64(64)", "uint64", "w.Uint64(%s)", "uint64"},
+	"float32": {"l.Float64(32)", "float64", "w.Float64(%s, 32)", "float64"},
+	"float64": {"l.Float64(64)", "float64", "w.Float64(%s, 64)", "float64"},
+}
+
+// basic встроенный тип под именем name: сам встроенный или объявленный в файле на его основе
+func (g *gen) basic(name string) (string, bool) {
+	if _, ok := basicKinds[name]; ok {
+		return name, true
+	}
+	if under, ok := g.types[name].(*ast.Ident); ok {
+		return g.basic(under.Name)
+	}
+	return "", false
+}
+
+// addr адрес выражения: &x, но для (*p) просто p
+func addr(expr string) string {
+	if strings.HasPrefix(expr, "(*") && strings.HasSuffix(expr, ")") {
+		return expr[2 : len(expr)-1]
+	}
+	return "&" + expr
+}
+
+// unparen (*p) без лишних скобок: *p
+func unparen(expr string) string {
+	if strings.HasPrefix(expr, "(*") && strings.HasSuffix(expr, ")") {
+		return expr[1 : len(expr)-1]
+	}
+	return expr
+}
+
+func (g *gen) isStruct(name string) bool {
+	_, ok := g.types[name].(*ast.StructType)
+	return ok
+}
+
+var errByteSlice = errors.New("[]byte is not supported")
+
+func (g *gen) unsupported(t ast.Expr) error {
+	return fmt.Errorf("unsupported type %s", types.ExprString(t))
+}
+
+func (g *gen) decodeStruct(name string) error {
+	fields, err := g.fields(name)
+	if err != nil {
+		return err
+	}
+	g.printf("\nfunc %s%s(l *jsonrt.Lexer, out *%s) {\n", decodeFunc, name, name)
+	g.printf("if l.Null() {\nreturn\n}\n")
+	g.printf("l.Delim('{')\nfor l.More('}') {\nswitch string(l.Key()) {\n")
+	for _, f := range fields {
+		g.printf("case %q:\n", f.key)
+		if err := g.decode("out."+f.goName, f.typ, 0); err != nil {
+			return fmt.Errorf("%s.%s: %s", name, f.goName, err)
+		}
+	}
+	g.printf("default:\nl.Skip()\n}\n}\n}\n")
+	return nil
+}
+
+// decode код, который читает значение типа t в dst
+func (g *gen) decode(dst string, t ast.Expr, depth int) error {
+	switch t := t.(type) {
+	case *ast.Ident:
+		if g.isStruct(t.Name) {
+			g.printf("%s(l, %s)\n", g.need(decodeFunc, t.Name), addr(dst))
+			return nil
+		}
+		basic, ok := g.basic(t.Name)
+		if !ok {
+			return g.unsupported(t)
+		}
+		kind := basicKinds[basic]
+		read := kind.read
+		if t.Name != kind.ret {
+			read = t.Name + "(" + read + ")"
+		}
+		g.printf("if !l.Null() {\n%s = %s\n}\n", unparen(dst), read)
+		return nil
+
+	case *ast.StarExpr:
+		g.printf("if l.Null() {\n%s = nil\n} else {\n", dst)
+		g.printf("if %s == nil {\n%s = new(%s)\n}\n", dst, dst, types.ExprString(t.X))
+		if err := g.decode("(*"+dst+")", t.X, depth); err != nil {
+			return err
+		}
+		g.printf("}\n")
+		return nil
+
+	case *ast.ArrayType:
+		if t.Len != nil {
+			return g.unsupported(t)
+		}
+		if elem, ok := t.Elt.(*ast.Ident); ok && (elem.Name == "byte" || elem.Name == "uint8") {
+			return errByteSlice
+		}
+		s, v := fmt.Sprintf("s%d", depth), fmt.Sprintf("v%d", depth)
+		g.printf("if l.Null() {\n%s = nil\n} else {\n", dst)
+		// как encoding/json: память старого среза переиспользуется, [] - пустой, но не nil срез
+		g.printf("%s := %s[:0]\nif %s == nil {\n%s = %s{}\n}\n", s, dst, s, s, types.ExprString(t))
+		g.printf("l.Delim('[')\nfor l.More(']') {\nvar %s %s\n", v, types.ExprString(t.Elt))
+		if err := g.decode(v, t.Elt, depth+1); err != nil {
+			return err
+		}
+		g.printf("%s = append(%s, %s)\n}\n%s = %s\n}\n", s, s, v, dst, s)
+		return nil
+	}
+	return g.unsupported(t)
+}
+
+// jsonKey ключ с двоеточием как литерал go: "\"name\":", с prefix перед ним
+func jsonKey(prefix, key string) string {
+	quoted, _ := json.Marshal(key)
+	return strconv.Quote(prefix + string(quoted) + ":")
+}
+
+func (g *gen) encodeStruct(name string) error {
+	fields, err := g.fields(name)
+	if err != nil {
+		return err
+	}
+	g.printf("\nfunc %s%s(w *jsonrt.Writer, in *%s) {\n", encodeFunc, name, name)
+	g.printf("w.RawByte('{')\n")
+	// surely - какое-то поле до текущего записано точно, maybe - могло быть записано
+	surely, maybe := false, false
+	for _, f := range fields {
+		src := "in." + f.goName
+		if f.omitempty {
+			cond, err := g.nonEmpty(src, f.typ)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %s", name, f.goName, err)
+			}
+			g.printf("if %s {\n", cond)
+		}
+		switch {
+		case surely:
+			g.printf("w.RawString(%s)\n", jsonKey(",", f.key))
+		case maybe:
+			g.printf("w.Comma()\nw.RawString(%s)\n", jsonKey("", f.key))
+		default:
+			g.printf("w.RawString(%s)\n", jsonKey("", f.key))
+		}
+		if err := g.encode(src, f.typ, 0); err != nil {
+			return fmt.Errorf("%s.%s: %s", name, f.goName, err)
+		}
+		if f.omitempty {
+			g.printf("}\n")
+		} else {
+			surely = true
+		}
+		maybe = true
+	}
+	g.printf("w.RawByte('}')\n}\n")
+	return nil
+}
+
+// nonEmpty условие, при котором поле с omitempty пишется
+func (g *gen) nonEmpty(src string, t ast.Expr) (string, error) {
+	switch t := t.(type) {
+	case *ast.Ident:
+		if g.isStruct(t.Name) {
+			// как в encoding/json: структура пустой не бывает
+			return "true", nil
+		}
+		basic, ok := g.basic(t.Name)
+		switch {
+		case !ok:
+			return "", g.unsupported(t)
+		case basic == "string":
+			return src + ` != ""`, nil
+		case basic == "bool":
+			return src, nil
+		}
+		return src + " != 0", nil
+	case *ast.StarExpr:
+		return src + " != nil", nil
+	case *ast.ArrayType:
+		return "len(" + src + ") != 0", nil
+	}
+	return "", g.unsupported(t)
+}
+
+// encode код, который пишет значение src типа t
+func (g *gen) encode(src string, t ast.Expr, depth int) error {
+	switch t := t.(type) {
+	case *ast.Ident:
+		if g.isStruct(t.Name) {
+			g.printf("%s(w, %s)\n", g.need(encodeFunc, t.Name), addr(src))
+			return nil
+		}
+		basic, ok := g.basic(t.Name)
+		if !ok {
+			return g.unsupported(t)
+		}
+		kind := basicKinds[basic]
+		src = unparen(src)
+		if t.Name != kind.conv {
+			src = kind.conv + "(" + src + ")"
+		}
+		g.printf(kind.write+"\n", src)
+		return nil
+
+	case *ast.StarExpr:
+		g.printf("if %s == nil {\nw.RawString(\"null\")\n} else {\n", src)
+		if err := g.encode("(*"+src+")", t.X, depth); err != nil {
+			return err
+		}
+		g.printf("}\n")
+		return nil
+
+	case *ast.ArrayType:
+		if t.Len != nil {
+			return g.unsupported(t)
+		}
+		if elem, ok := t.Elt.(*ast.Ident); ok && (elem.Name == "byte" || elem.Name == "uint8") {
+			return errByteSlice
+		}
+		i := fmt.Sprintf("i%d", depth)
+		g.printf("if %s == nil {\nw.RawString(\"null\")\n} else {\n", src)
+		g.printf("w.RawByte('[')\nfor %s := range %s {\n", i, src)
+		g.printf("if %s > 0 {\nw.RawByte(',')\n}\n", i)
+		if err := g.encode(src+"["+i+"]", t.Elt, depth+1); err != nil {
+			return err
+		}
+		g.printf("}\nw.RawByte(']')\n}\n")
+		return nil
+	}
+	return g.unsupported(t)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// TestGenerated закоммиченный код совпадает с тем, что генерируется сейчас
+func TestGenerated(t *testing.T) {
+	for in, out := range map[string]string{
+		"../models/models.go": "../models/models_json.go",
+		"example/example.go":  "example/example_json.go",
+	} {
+		src, err := ioutil.ReadFile(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := generate(in, src)
+		if err != nil {
+			t.Fatalf("%s: %s", in, err)
+		}
+		committed, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(code) != string(committed) {
+			t.Errorf("%s is out of date, run go generate", out)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	cases := map[string]string{
+		"map":        "// jsongen: json\ntype A struct { M map[string]int }",
+		"bytes":      "// jsongen: json\ntype A struct { B []byte }",
+		"array":      "// jsongen: json\ntype A struct { B [4]int }",
+		"embedded":   "type B struct{}\n// jsongen: json\ntype A struct { B }",
+		"foreign":    "// jsongen: json\ntype A struct { T time.Time }",
+		"option":     "// jsongen: json\ntype A struct { N int `json:\",string\"` }",
+		"duplicate":  "// jsongen: json\ntype A struct { X int `json:\"a\"`; Y int `json:\"a\"` }",
+		"mark":       "// jsongen: yaml\ntype A struct {}",
+		"not struct": "// jsongen: json\ntype A int",
+		"no marks":   "type A struct {}",
+	}
+	for name, src := range cases {
+		_, err := generate(name+".go", []byte("package p\n\n"+src+"\n"))
+		if err == nil {
+			t.Errorf("[%s] expected error", name)
+		}
+	}
+
+	code, err := generate("ok.go", []byte("package p\n\n// jsongen: json decode\ntype A struct { X int }\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(code), "MarshalJSON()") || !strings.Contains(string(code), "FastSkip: true") {
+		t.Errorf("decode only mode expected:\n%s", code)
+	}
+}
@@ -0,0 +1,162 @@
+package jsonrt
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestWriterString(t *testing.T) {
+	cases := []string{"", "plain", "q\"b\\s/", "<a href=\"x\">&amp;</a>", "\x00\x01\b\f\n\r\t\x1f\x7f",
+		"привет 😀", "bad\xffutf8\xc3", "\u2028\u2029", "\xed\xa0\x80"}
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n < 1000; n++ {
+		b := make([]byte, rnd.Intn(20))
+		for i := range b {
+			b[i] = byte(rnd.Intn(256))
+		}
+		cases = append(cases, string(b))
+	}
+	for _, s := range cases {
+		expected, _ := json.Marshal(s)
+		w := Writer{}
+		w.String(s)
+		if string(w.Buf) != string(expected) {
+			t.Errorf("%q: got %s, expected %s", s, w.Buf, expected)
+		}
+	}
+}
+
+func TestWriterNumbers(t *testing.T) {
+	floats := []float64{0, 1, -1, 0.1, 1.5e-7, 1e-6, 123456789, 1e20, 1e21, -2.5e300, math.SmallestNonzeroFloat64, math.MaxFloat32}
+	for _, f := range floats {
+		w := Writer{}
+		w.Float64(f, 64)
+		expected, _ := json.Marshal(f)
+		if string(w.Buf) != string(expected) {
+			t.Errorf("float64 %v: got %s, expected %s", f, w.Buf, expected)
+		}
+
+		if math.IsInf(float64(float32(f)), 0) {
+			continue
+		}
+		w = Writer{}
+		w.Float64(float64(float32(f)), 32)
+		expected, _ = json.Marshal(float32(f))
+		if string(w.Buf) != string(expected) {
+			t.Errorf("float32 %v: got %s, expected %s", f, w.Buf, expected)
+		}
+	}
+
+	w := Writer{}
+	w.Float64(math.NaN(), 64)
+	w.Int64(math.MinInt64)
+	w.Uint64(math.MaxUint64)
+	w.Bool(true)
+	if expected := "null-922337203685477580818446744073709551615true"; string(w.Buf) != expected {
+		t.Errorf("got %s, expected %s", w.Buf, expected)
+	}
+}
+
+func TestLexerString(t *testing.T) {
+	cases := []string{`""`, `"plain"`, `"a\"b\\c\/d\b\f\n\r\t"`, `"Aé中"`, `"😀"`,
+		`"\ud800"`, `"\ud800A"`, `"\udc00\ud800"`, "\"bad\xffutf8\xc3\"", `"привет"`}
+	for _, c := range cases {
+		expected := ""
+		if err := json.Unmarshal([]byte(c), &expected); err != nil {
+			t.Fatalf("%s: bad test data: %s", c, err)
+		}
+		l := Lexer{Data: []byte(c)}
+		got := l.String()
+		l.End()
+		if err := l.Error(); err != nil {
+			t.Errorf("%s: %s", c, err)
+		}
+		if got != expected {
+			t.Errorf("%s: got %q, expected %q", c, got, expected)
+		}
+	}
+}
+
+func TestLexerNumbers(t *testing.T) {
+	l := Lexer{Data: []byte(`[-12, 0, 3.5e2, 255, 1E-2]`)}
+	l.Delim('[')
+	got := []float64{}
+	l.More(']')
+	got = append(got, float64(l.Int64(8)))
+	l.More(']')
+	got = append(got, float64(l.Uint64(64)))
+	l.More(']')
+	got = append(got, l.Float64(64))
+	l.More(']')
+	got = append(got, float64(l.Uint64(8)))
+	l.More(']')
+	got = append(got, l.Float64(32))
+	if l.More(']') || l.Error() != nil {
+		t.Fatalf("got error %v", l.Error())
+	}
+	expected := []float64{-12, 0, 350, 255, float64(float32(0.01))}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("[%d] got %v, expected %v", i, got[i], expected[i])
+		}
+	}
+
+	for _, c := range []string{`256`, `-1`, `01`, `1.`, `.5`, `1e`, `-`, `1.5`} {
+		l := Lexer{Data: []byte(c)}
+		l.Uint64(8)
+		if l.Error() == nil {
+			t.Errorf("%s: expected error", c)
+		}
+	}
+}
+
+func TestLexerSkip(t *testing.T) {
+	valid := []string{`{}`, `[]`, `{"a":[1,{"b":"}]"},null,true,false,-1.5e3],"c":"\"{"}`, `"x"`, `12`, `null`}
+	invalid := []string{`{"a":}`, `[1,]`, `{"a" 1}`, `[1 2]`, `{"a":1,}`, `"\x"`, `tru`, `[`}
+	for _, fast := range []bool{false, true} {
+		for _, c := range valid {
+			l := Lexer{Data: []byte(" " + c + " "), FastSkip: fast}
+			l.Skip()
+			l.End()
+			if err := l.Error(); err != nil {
+				t.Errorf("fast=%v %s: %s", fast, c, err)
+			}
+		}
+	}
+	// быстрый пропуск не проверяет содержимое, поэтому плохой json ловит только обычный
+	for _, c := range invalid {
+		l := Lexer{Data: []byte(c)}
+		l.Skip()
+		l.End()
+		if l.Error() == nil {
+			t.Errorf("%s: expected error", c)
+		}
+	}
+}
+
+func TestLexerObject(t *testing.T) {
+	for c, ok := range map[string]bool{
+		`{"a":1,"b":2}`:   true,
+		` { "a" : 1 } `:   true,
+		`{}`:              true,
+		`{"a":1 "b":2}`:   false,
+		`{"a":1,}`:        false,
+		`{,"a":1}`:        false,
+		`{"a":1}}`:        false,
+		`{"a":1`:          false,
+		`{"a":1,"b":[1]}`: true,
+	} {
+		l := Lexer{Data: []byte(c)}
+		l.Delim('{')
+		for l.More('}') {
+			l.Key()
+			l.Skip()
+		}
+		l.End()
+		if got := l.Error() == nil; got != ok {
+			t.Errorf("%s: got ok=%v, error %v", c, got, l.Error())
+		}
+	}
+}
@@ -0,0 +1,479 @@
+// Package jsonrt то, на что опирается код из json_gen: разбор json без рефлексии
+// и запись в буфер без аллокаций на каждое поле
+package jsonrt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Lexer разбирает Data слева направо. Первая ошибка запоминается, после неё все методы
+// ничего не делают и возвращают нулевые значения, так что сгенерированный код проверяет
+// ошибку один раз в конце
+type Lexer struct {
+	Data []byte
+	// FastSkip незнакомые поля пропускаются по скобкам и кавычкам без проверки, что внутри json
+	FastSkip bool
+
+	pos int
+	err error
+}
+
+// Error первая ошибка разбора
+func (l *Lexer) Error() error {
+	return l.err
+}
+
+func (l *Lexer) fail(format string, args ...interface{}) {
+	if l.err == nil {
+		l.err = fmt.Errorf("json: offset %d: %s", l.pos, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l *Lexer) skipSpace() {
+	for l.pos < len(l.Data) {
+		switch l.Data[l.pos] {
+		case ' ', '\t', '\n', '\r':
+			l.pos++
+		default:
+			return
+		}
+	}
+}
+
+// peek следующий значимый байт, 0 - конец данных или ошибка
+func (l *Lexer) peek() byte {
+	if l.err != nil {
+		return 0
+	}
+	l.skipSpace()
+	if l.pos == len(l.Data) {
+		return 0
+	}
+	return l.Data[l.pos]
+}
+
+// End после значения могут быть только пробелы
+func (l *Lexer) End() {
+	if c := l.peek(); c != 0 {
+		l.fail("unexpected %q after value", c)
+	}
+}
+
+// Null съедает null и говорит, был ли он
+func (l *Lexer) Null() bool {
+	if l.peek() == 'n' {
+		l.literal("null")
+		return l.err == nil
+	}
+	return false
+}
+
+func (l *Lexer) literal(lit string) {
+	if len(l.Data)-l.pos < len(lit) || string(l.Data[l.pos:l.pos+len(lit)]) != lit {
+		l.fail("expected %s", lit)
+		return
+	}
+	l.pos += len(lit)
+}
+
+// Delim съедает ожидаемую скобку
+func (l *Lexer) Delim(c byte) {
+	if got := l.peek(); got != c {
+		l.unexpected(c)
+		return
+	}
+	l.pos++
+}
+
+func (l *Lexer) unexpected(expected byte) {
+	if l.pos == len(l.Data) {
+		l.fail("unexpected end, expected %q", expected)
+	} else {
+		l.fail("unexpected %q, expected %q", l.Data[l.pos], expected)
+	}
+}
+
+// More есть ли ещё элемент до закрывающей скобки close. Запятые между элементами съедает сам:
+//
+//	l.Delim('[')
+//	for l.More(']') { ... }
+//
+// После false скобка уже съедена
+func (l *Lexer) More(close byte) bool {
+	c := l.peek()
+	if c == close {
+		l.pos++
+		return false
+	}
+	if l.err != nil {
+		return false
+	}
+	prev := l.prevSignificant()
+	if prev == '[' || prev == '{' {
+		return true
+	}
+	if c != ',' {
+		l.unexpected(close)
+		return false
+	}
+	l.pos++
+	if l.peek() == close {
+		l.fail("trailing comma")
+		return false
+	}
+	return l.err == nil
+}
+
+// prevSignificant последний съеденный не пробельный байт
+func (l *Lexer) prevSignificant() byte {
+	for i := l.pos - 1; i >= 0; i-- {
+		switch c := l.Data[i]; c {
+		case ' ', '\t', '\n', '\r':
+		default:
+			return c
+		}
+	}
+	return 0
+}
+
+// Key ключ объекта вместе с двоеточием. Срез годится только до следующего вызова:
+// без экранирования он смотрит прямо в Data
+func (l *Lexer) Key() []byte {
+	key := l.stringBytes()
+	if l.peek() != ':' {
+		l.unexpected(':')
+		return nil
+	}
+	l.pos++
+	return key
+}
+
+// String строка; невалидный utf-8 заменяется на U+FFFD, как в encoding/json
+func (l *Lexer) String() string {
+	return string(l.stringBytes())
+}
+
+var errBadString = errors.New("bad string")
+
+// plainByte байты, которые в строке можно брать как есть
+var plainByte = func() (t [256]bool) {
+	for c := 0x20; c < 256; c++ {
+		t[c] = c != '"' && c != '\\'
+	}
+	return t
+}()
+
+func (l *Lexer) stringBytes() []byte {
+	if l.peek() != '"' {
+		l.unexpected('"')
+		return nil
+	}
+	start := l.pos + 1
+	// быстрый путь: без экранирования и с валидным utf-8 результат - срез Data
+	i, high := start, byte(0)
+	for ; i < len(l.Data); i++ {
+		c := l.Data[i]
+		if !plainByte[c] {
+			break
+		}
+		high |= c
+	}
+	if i < len(l.Data) && l.Data[i] == '"' {
+		if s := l.Data[start:i]; high < utf8.RuneSelf || utf8.Valid(s) {
+			l.pos = i + 1
+			return s
+		}
+	}
+	res, end, err := unquote(l.Data, start)
+	if err != nil {
+		l.pos = end
+		l.fail("%s", err)
+		return nil
+	}
+	l.pos = end
+	return res
+}
+
+// unquote раскодирует строку, начиная с data[start] (после открывающей кавычки).
+// end - позиция после закрывающей кавычки
+func unquote(data []byte, start int) (res []byte, end int, err error) {
+	res = make([]byte, 0, 16)
+	i := start
+	for i < len(data) {
+		c := data[i]
+		switch {
+		case c == '"':
+			return res, i + 1, nil
+		case c < 0x20:
+			return nil, i, errBadString
+		case c == '\\':
+			if i+1 == len(data) {
+				return nil, i, errBadString
+			}
+			i++
+			switch e := data[i]; e {
+			case '"', '\\', '/':
+				res = append(res, e)
+			case 'b':
+				res = append(res, '\b')
+			case 'f':
+				res = append(res, '\f')
+			case 'n':
+				res = append(res, '\n')
+			case 'r':
+				res = append(res, '\r')
+			case 't':
+				res = append(res, '\t')
+			case 'u':
+				r, ok := hex4(data, i+1)
+				if !ok {
+					return nil, i, errBadString
+				}
+				i += 4
+				if utf16.IsSurrogate(r) {
+					// вторая половина пары, иначе U+FFFD
+					if r2, ok := hex4(data, i+3); ok && i+2 < len(data) && data[i+1] == '\\' && data[i+2] == 'u' {
+						if dec := utf16.DecodeRune(r, r2); dec != utf8.RuneError {
+							r = dec
+							i += 6
+						} else {
+							r = utf8.RuneError
+						}
+					} else {
+						r = utf8.RuneError
+					}
+				}
+				res = appendRune(res, r)
+			default:
+				return nil, i, errBadString
+			}
+			i++
+		case c < utf8.RuneSelf:
+			res = append(res, c)
+			i++
+		default:
+			r, size := utf8.DecodeRune(data[i:])
+			if r == utf8.RuneError && size == 1 {
+				res = appendRune(res, utf8.RuneError)
+			} else {
+				res = append(res, data[i:i+size]...)
+			}
+			i += size
+		}
+	}
+	return nil, i, errBadString
+}
+
+func appendRune(dst []byte, r rune) []byte {
+	var buf [utf8.UTFMax]byte
+	return append(dst, buf[:utf8.EncodeRune(buf[:], r)]...)
+}
+
+func hex4(data []byte, i int) (rune, bool) {
+	if i+4 > len(data) {
+		return 0, false
+	}
+	r := rune(0)
+	for _, c := range data[i : i+4] {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c -= 'a' - 10
+		case c >= 'A' && c <= 'F':
+			c -= 'A' - 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, true
+}
+
+// Bool true или false
+func (l *Lexer) Bool() bool {
+	switch l.peek() {
+	case 't':
+		l.literal("true")
+		return true
+	case 'f':
+		l.literal("false")
+	default:
+		l.fail("expected bool")
+	}
+	return false
+}
+
+// number байты числа по грамматике json
+func (l *Lexer) number() []byte {
+	c := l.peek()
+	if c != '-' && (c < '0' || c > '9') {
+		l.fail("expected number")
+		return nil
+	}
+	start := l.pos
+	i := l.pos
+	if l.Data[i] == '-' {
+		i++
+	}
+	digits := func() int {
+		n := 0
+		for i < len(l.Data) && l.Data[i] >= '0' && l.Data[i] <= '9' {
+			i++
+			n++
+		}
+		return n
+	}
+	intStart := i
+	if n := digits(); n == 0 || n > 1 && l.Data[intStart] == '0' {
+		l.fail("bad number")
+		return nil
+	}
+	if i < len(l.Data) && l.Data[i] == '.' {
+		i++
+		if digits() == 0 {
+			l.fail("bad number")
+			return nil
+		}
+	}
+	if i < len(l.Data) && (l.Data[i] == 'e' || l.Data[i] == 'E') {
+		i++
+		if i < len(l.Data) && (l.Data[i] == '+' || l.Data[i] == '-') {
+			i++
+		}
+		if digits() == 0 {
+			l.fail("bad number")
+			return nil
+		}
+	}
+	l.pos = i
+	return l.Data[start:i]
+}
+
+// Int64 целое, которое помещается в bits бит
+func (l *Lexer) Int64(bits int) int64 {
+	num := l.number()
+	if l.err != nil {
+		return 0
+	}
+	n, err := strconv.ParseInt(string(num), 10, bits)
+	if err != nil {
+		l.fail("%s", err)
+	}
+	return n
+}
+
+// Uint64 неотрицательное целое, которое помещается в bits бит
+func (l *Lexer) Uint64(bits int) uint64 {
+	num := l.number()
+	if l.err != nil {
+		return 0
+	}
+	n, err := strconv.ParseUint(string(num), 10, bits)
+	if err != nil {
+		l.fail("%s", err)
+	}
+	return n
+}
+
+// Int целое размером с int
+func (l *Lexer) Int() int {
+	return int(l.Int64(strconv.IntSize))
+}
+
+// Uint неотрицательное целое размером с uint
+func (l *Lexer) Uint() uint {
+	return uint(l.Uint64(strconv.IntSize))
+}
+
+// Float64 число с точностью bits (32 или 64)
+func (l *Lexer) Float64(bits int) float64 {
+	num := l.number()
+	if l.err != nil {
+		return 0
+	}
+	f, err := strconv.ParseFloat(string(num), bits)
+	if err != nil {
+		l.fail("%s", err)
+	}
+	return f
+}
+
+// Skip пропускает значение: с проверкой или, если FastSkip, только по скобкам и кавычкам
+func (l *Lexer) Skip() {
+	if l.FastSkip {
+		l.skipFast()
+		return
+	}
+	switch c := l.peek(); {
+	case c == '{':
+		l.pos++
+		for l.More('}') {
+			l.Key()
+			l.Skip()
+		}
+	case c == '[':
+		l.pos++
+		for l.More(']') {
+			l.Skip()
+		}
+	case c == '"':
+		l.stringBytes()
+	case c == 't' || c == 'f':
+		l.Bool()
+	case c == 'n':
+		l.literal("null")
+	default:
+		l.number()
+	}
+}
+
+// skipFast конец значения без разбора: внутри строк смотрим только на кавычку и обратный слеш
+func (l *Lexer) skipFast() {
+	c := l.peek()
+	if c != '{' && c != '[' && c != '"' {
+		// число или литерал: до разделителя
+		for l.pos < len(l.Data) {
+			switch l.Data[l.pos] {
+			case ',', '}', ']', ' ', '\t', '\n', '\r':
+				return
+			}
+			l.pos++
+		}
+		return
+	}
+	depth := 0
+	for i := l.pos; i < len(l.Data); i++ {
+		switch l.Data[i] {
+		case '"':
+			for i++; i < len(l.Data) && l.Data[i] != '"'; i++ {
+				if l.Data[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(l.Data) {
+				l.pos = len(l.Data)
+				l.fail("unterminated string")
+				return
+			}
+			if depth == 0 {
+				l.pos = i + 1
+				return
+			}
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				l.pos = i + 1
+				return
+			}
+		}
+	}
+	l.pos = len(l.Data)
+	l.fail("unexpected end")
+}
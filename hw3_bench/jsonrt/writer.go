@@ -0,0 +1,124 @@
+package jsonrt
+
+import (
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Writer дописывает json в Buf. Экранирует строки так же, как encoding/json,
+// чтобы вывод совпадал байт в байт
+type Writer struct {
+	Buf []byte
+}
+
+// RawByte байт как есть
+func (w *Writer) RawByte(c byte) {
+	w.Buf = append(w.Buf, c)
+}
+
+// RawString строка как есть, без кавычек и экранирования
+func (w *Writer) RawString(s string) {
+	w.Buf = append(w.Buf, s...)
+}
+
+// Comma запятая перед полем объекта, если это не первое поле
+func (w *Writer) Comma() {
+	if n := len(w.Buf); n > 0 && w.Buf[n-1] != '{' {
+		w.Buf = append(w.Buf, ',')
+	}
+}
+
+const hexDigits = "0123456789abcdef"
+
+// String строка в кавычках. <, >, & и U+2028, U+2029 экранируются, невалидный utf-8 - U+FFFD
+func (w *Writer) String(s string) {
+	buf := append(w.Buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				buf = append(buf, '\\', c)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			case '\b':
+				buf = append(buf, '\\', 'b')
+			case '\f':
+				buf = append(buf, '\\', 'f')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	w.Buf = append(append(buf, s[start:]...), '"')
+}
+
+// Int64 целое
+func (w *Writer) Int64(n int64) {
+	w.Buf = strconv.AppendInt(w.Buf, n, 10)
+}
+
+// Uint64 неотрицательное целое
+func (w *Writer) Uint64(n uint64) {
+	w.Buf = strconv.AppendUint(w.Buf, n, 10)
+}
+
+// Bool true или false
+func (w *Writer) Bool(b bool) {
+	w.Buf = strconv.AppendBool(w.Buf, b)
+}
+
+// Float64 число с точностью bits, в том же виде, что у encoding/json.
+// NaN и бесконечности в json не записать, вместо них пишется null
+func (w *Writer) Float64(f float64, bits int) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		w.Buf = append(w.Buf, "null"...)
+		return
+	}
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	buf := strconv.AppendFloat(w.Buf, f, format, -1, bits)
+	if format == 'e' {
+		// 1e-07 -> 1e-7
+		if n := len(buf); n >= 4 && buf[n-4] == 'e' && buf[n-3] == '-' && buf[n-2] == '0' {
+			buf[n-2] = buf[n-1]
+			buf = buf[:n-1]
+		}
+	}
+	w.Buf = buf
+}
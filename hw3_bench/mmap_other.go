@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile на этих платформах не поддерживается, SearchFile читает файл через Search
+func mmapFile(file *os.File) (data []byte, unmap func() error, err error) {
+	return nil, nil, errors.New("mmap: not supported")
+}
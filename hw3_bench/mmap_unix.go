@@ -0,0 +1,35 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// mmapFile отображает обычный файл в память только на чтение, unmap освобождает отображение
+func mmapFile(file *os.File) (data []byte, unmap func() error, err error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil, errors.New("mmap: not a regular file")
+	}
+	size := info.Size()
+	if size == 0 {
+		// пустой файл отобразить нельзя
+		return []byte{}, func() error { return nil }, nil
+	}
+	if int64(int(size)) != size {
+		return nil, nil, errors.New("mmap: file too large")
+	}
+
+	data, err = syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -1,7 +1,12 @@
 package models
 
+//go:generate go run ../json_gen models.go models_json.go
+
+// jsongen: json
 type User struct {
 	Browsers []string `json:"browsers"`
+	Company  string   `json:"company"`
+	Country  string   `json:"country"`
 	Email    string   `json:"email"`
 	Name     string   `json:"name"`
 }
@@ -0,0 +1,93 @@
+// Code generated by json_gen. DO NOT EDIT.
+
+package models
+
+import "github.com/moguchev/coursera_go/hw3_bench/jsonrt"
+
+// UnmarshalJSON реализует json.Unmarshaler
+func (out *User) UnmarshalJSON(data []byte) error {
+	l := jsonrt.Lexer{Data: data, FastSkip: false}
+	jsonDecodeUser(&l, out)
+	l.End()
+	return l.Error()
+}
+
+// MarshalJSON реализует json.Marshaler
+func (in User) MarshalJSON() ([]byte, error) {
+	w := jsonrt.Writer{}
+	jsonEncodeUser(&w, &in)
+	return w.Buf, nil
+}
+
+func jsonDecodeUser(l *jsonrt.Lexer, out *User) {
+	if l.Null() {
+		return
+	}
+	l.Delim('{')
+	for l.More('}') {
+		switch string(l.Key()) {
+		case "browsers":
+			if l.Null() {
+				out.Browsers = nil
+			} else {
+				s0 := out.Browsers[:0]
+				if s0 == nil {
+					s0 = []string{}
+				}
+				l.Delim('[')
+				for l.More(']') {
+					var v0 string
+					if !l.Null() {
+						v0 = l.String()
+					}
+					s0 = append(s0, v0)
+				}
+				out.Browsers = s0
+			}
+		case "company":
+			if !l.Null() {
+				out.Company = l.String()
+			}
+		case "country":
+			if !l.Null() {
+				out.Country = l.String()
+			}
+		case "email":
+			if !l.Null() {
+				out.Email = l.String()
+			}
+		case "name":
+			if !l.Null() {
+				out.Name = l.String()
+			}
+		default:
+			l.Skip()
+		}
+	}
+}
+
+func jsonEncodeUser(w *jsonrt.Writer, in *User) {
+	w.RawByte('{')
+	w.RawString("\"browsers\":")
+	if in.Browsers == nil {
+		w.RawString("null")
+	} else {
+		w.RawByte('[')
+		for i0 := range in.Browsers {
+			if i0 > 0 {
+				w.RawByte(',')
+			}
+			w.String(in.Browsers[i0])
+		}
+		w.RawByte(']')
+	}
+	w.RawString(",\"company\":")
+	w.String(in.Company)
+	w.RawString(",\"country\":")
+	w.String(in.Country)
+	w.RawString(",\"email\":")
+	w.String(in.Email)
+	w.RawString(",\"name\":")
+	w.String(in.Name)
+	w.RawByte('}')
+}
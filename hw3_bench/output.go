@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format формат вывода найденных пользователей
+type Format int
+
+const (
+	// FormatText как у SlowSearch: "[i] name <email>" и итог "Total unique browsers"
+	FormatText Format = iota
+	// FormatJSON json lines: объект на пользователя, последней строкой {"total_unique_browsers":N}
+	// и, если считались, "top_browsers"
+	FormatJSON
+	// FormatCSV строка заголовков и по строке на пользователя. Итога (числа уникальных браузеров и топа)
+	// нет: строка другой формы сломала бы таблицу, он есть в FormatText и FormatJSON
+	FormatCSV
+)
+
+// EmailPolicy как печатать email
+type EmailPolicy int
+
+const (
+	// EmailObfuscated каждая @ заменяется на " [at] ", как у SlowSearch
+	EmailObfuscated EmailPolicy = iota
+	EmailPlain
+	// EmailHashed sha256 от email в hex: можно сравнивать, нельзя прочитать
+	EmailHashed
+)
+
+var emailPolicyNames = []string{"obfuscated", "plain", "hashed"}
+
+// ParseEmailPolicy "obfuscated", "plain" или "hashed"
+func ParseEmailPolicy(s string) (EmailPolicy, error) {
+	for i, name := range emailPolicyNames {
+		if s == name {
+			return EmailPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown email policy %q", s)
+}
+
+// OutputField поле пользователя в JSON и CSV
+type OutputField int
+
+const (
+	// OutIndex номер строки во входном файле
+	OutIndex OutputField = iota
+	OutName
+	OutEmail
+	OutCompany
+	OutCountry
+	OutBrowsers
+)
+
+var outputFieldNames = []string{"index", "name", "email", "company", "country", "browsers"}
+
+func (f OutputField) String() string {
+	if f < 0 || int(f) >= len(outputFieldNames) {
+		return "OutputField(" + strconv.Itoa(int(f)) + ")"
+	}
+	return outputFieldNames[f]
+}
+
+// ParseFields поля через запятую: "index,name,email"
+func ParseFields(s string) ([]OutputField, error) {
+	fields := []OutputField{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for i, known := range outputFieldNames {
+			if name == known {
+				fields = append(fields, OutputField(i))
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+	}
+	return fields, nil
+}
+
+// Output как печатать найденных пользователей. Нулевое значение - формат SlowSearch
+type Output struct {
+	Format Format
+	// Fields поля JSON и CSV по порядку, по умолчанию index, name, email.
+	// Текстовый формат всегда печатает номер, имя и email
+	Fields []OutputField
+	Email  EmailPolicy
+}
+
+var defaultFields = []OutputField{OutIndex, OutName, OutEmail}
+
+// outWriter печатает пользователей в буфер без fmt, строка собирается в buf и пишется целиком
+type outWriter struct {
+	w      *bufio.Writer
+	format Format
+	fields []OutputField
+	email  EmailPolicy
+	buf    []byte
+	tmp    []byte // email или браузеры до экранирования
+}
+
+func newOutWriter(w io.Writer, out Output) *outWriter {
+	fields := out.Fields
+	if len(fields) == 0 {
+		fields = defaultFields
+	}
+	return &outWriter{w: bufio.NewWriter(w), format: out.Format, fields: fields, email: out.Email}
+}
+
+func (o *outWriter) header() error {
+	switch o.format {
+	case FormatText:
+		o.buf = append(o.buf[:0], "found users:\n"...)
+	case FormatCSV:
+		o.buf = o.buf[:0]
+		for i, f := range o.fields {
+			if i > 0 {
+				o.buf = append(o.buf, ',')
+			}
+			o.buf = append(o.buf, f.String()...)
+		}
+		o.buf = append(o.buf, '\n')
+	default:
+		return nil
+	}
+	_, err := o.w.Write(o.buf)
+	return err
+}
+
+func (o *outWriter) user(index int, v *userView) error {
+	switch o.format {
+	case FormatText:
+		o.buf = append(o.buf[:0], '[')
+		o.buf = strconv.AppendInt(o.buf, int64(index), 10)
+		o.buf = append(o.buf, "] "...)
+		o.buf = append(o.buf, v.Name...)
+		o.buf = append(o.buf, " <"...)
+		o.buf = o.appendEmail(o.buf, v.Email)
+		o.buf = append(o.buf, ">\n"...)
+	case FormatJSON:
+		o.buf = append(o.buf[:0], '{')
+		for i, f := range o.fields {
+			if i > 0 {
+				o.buf = append(o.buf, ',')
+			}
+			o.buf = append(o.buf, '"')
+			o.buf = append(o.buf, f.String()...)
+			o.buf = append(o.buf, `":`...)
+			o.buf = o.appendJSONField(o.buf, f, index, v)
+		}
+		o.buf = append(o.buf, "}\n"...)
+	case FormatCSV:
+		o.buf = o.buf[:0]
+		for i, f := range o.fields {
+			if i > 0 {
+				o.buf = append(o.buf, ',')
+			}
+			o.buf = o.appendCSVField(o.buf, f, index, v)
+		}
+		o.buf = append(o.buf, '\n')
+	}
+	_, err := o.w.Write(o.buf)
+	return err
+}
+
+// footer итог, самые частые браузеры, если их считали, и сброс буфера
+func (o *outWriter) footer(uniqueBrowsers int, top []BrowserCount) error {
+	switch o.format {
+	case FormatText:
+		o.buf = append(o.buf[:0], "\nTotal unique browsers "...)
+		o.buf = strconv.AppendInt(o.buf, int64(uniqueBrowsers), 10)
+		o.buf = append(o.buf, '\n')
+		if len(top) > 0 {
+			o.buf = append(o.buf, "\nTop browsers:\n"...)
+		}
+		for _, bc := range top {
+			o.buf = strconv.AppendUint(o.buf, bc.Count, 10)
+			o.buf = append(o.buf, ' ')
+			o.buf = append(o.buf, bc.Browser...)
+			o.buf = append(o.buf, '\n')
+		}
+		if _, err := o.w.Write(o.buf); err != nil {
+			return err
+		}
+	case FormatJSON:
+		o.buf = append(o.buf[:0], `{"total_unique_browsers":`...)
+		o.buf = strconv.AppendInt(o.buf, int64(uniqueBrowsers), 10)
+		if len(top) > 0 {
+			o.buf = append(o.buf, `,"top_browsers":[`...)
+		}
+		for i, bc := range top {
+			if i > 0 {
+				o.buf = append(o.buf, ',')
+			}
+			o.buf = append(o.buf, `{"browser":`...)
+			o.buf = appendJSONString(o.buf, []byte(bc.Browser))
+			o.buf = append(o.buf, `,"count":`...)
+			o.buf = strconv.AppendUint(o.buf, bc.Count, 10)
+			o.buf = append(o.buf, '}')
+		}
+		if len(top) > 0 {
+			o.buf = append(o.buf, ']')
+		}
+		o.buf = append(o.buf, "}\n"...)
+		if _, err := o.w.Write(o.buf); err != nil {
+			return err
+		}
+	}
+	return o.w.Flush()
+}
+
+func (o *outWriter) appendEmail(dst, email []byte) []byte {
+	switch o.email {
+	case EmailPlain:
+		return append(dst, email...)
+	case EmailHashed:
+		sum := sha256.Sum256(email)
+		var encoded [2 * sha256.Size]byte
+		hex.Encode(encoded[:], sum[:])
+		return append(dst, encoded[:]...)
+	}
+	for {
+		at := bytes.IndexByte(email, '@')
+		if at < 0 {
+			return append(dst, email...)
+		}
+		dst = append(dst, email[:at]...)
+		dst = append(dst, " [at] "...)
+		email = email[at+1:]
+	}
+}
+
+// fieldValue строковое значение поля, кроме index и browsers
+func fieldValue(f OutputField, v *userView) []byte {
+	switch f {
+	case OutName:
+		return v.Name
+	case OutCompany:
+		return v.Company
+	default:
+		return v.Country
+	}
+}
+
+func (o *outWriter) appendJSONField(dst []byte, f OutputField, index int, v *userView) []byte {
+	switch f {
+	case OutIndex:
+		return strconv.AppendInt(dst, int64(index), 10)
+	case OutEmail:
+		o.tmp = o.appendEmail(o.tmp[:0], v.Email)
+		return appendJSONString(dst, o.tmp)
+	case OutBrowsers:
+		dst = append(dst, '[')
+		for i, b := range v.Browsers {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendJSONString(dst, b)
+		}
+		return append(dst, ']')
+	default:
+		return appendJSONString(dst, fieldValue(f, v))
+	}
+}
+
+func (o *outWriter) appendCSVField(dst []byte, f OutputField, index int, v *userView) []byte {
+	switch f {
+	case OutIndex:
+		return strconv.AppendInt(dst, int64(index), 10)
+	case OutEmail:
+		o.tmp = o.appendEmail(o.tmp[:0], v.Email)
+		return appendCSVString(dst, o.tmp)
+	case OutBrowsers:
+		// браузеры в одной ячейке через |, | и \ внутри браузера экранируются \
+		o.tmp = o.tmp[:0]
+		for i, b := range v.Browsers {
+			if i > 0 {
+				o.tmp = append(o.tmp, '|')
+			}
+			for _, c := range b {
+				if c == '|' || c == '\\' {
+					o.tmp = append(o.tmp, '\\')
+				}
+				o.tmp = append(o.tmp, c)
+			}
+		}
+		return appendCSVString(dst, o.tmp)
+	default:
+		return appendCSVString(dst, fieldValue(f, v))
+	}
+}
+
+const hexDigits = "0123456789abcdef"
+
+func appendJSONString(dst, s []byte) []byte {
+	dst = append(dst, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			dst = append(dst, '\\', c)
+		case c == '\n':
+			dst = append(dst, '\\', 'n')
+		case c == '\r':
+			dst = append(dst, '\\', 'r')
+		case c == '\t':
+			dst = append(dst, '\\', 't')
+		case c < 0x20:
+			dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+		case c >= utf8.RuneSelf:
+			r, size := utf8.DecodeRune(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				dst = append(dst, `�`...)
+			} else {
+				dst = append(dst, s[i:i+size]...)
+			}
+			i += size
+			continue
+		default:
+			dst = append(dst, c)
+		}
+		i++
+	}
+	return append(dst, '"')
+}
+
+// appendCSVString в кавычках, только если без них ячейку не прочитать (RFC 4180)
+func appendCSVString(dst, s []byte) []byte {
+	quote := len(s) > 0 && (s[0] == ' ' || s[len(s)-1] == ' ')
+	for _, c := range s {
+		if c == ',' || c == '"' || c == '\n' || c == '\r' {
+			quote = true
+			break
+		}
+	}
+	if !quote {
+		return append(dst, s...)
+	}
+	dst = append(dst, '"')
+	for _, c := range s {
+		if c == '"' {
+			dst = append(dst, '"')
+		}
+		dst = append(dst, c)
+	}
+	return append(dst, '"')
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/moguchev/coursera_go/hw3_bench/datagen"
+)
+
+const outputInput = `{"browsers":["Android 4.0","MSIE 8.0"],"company":"Acme, Inc.","country":"Peru","email":"a@b.c","name":"Jo \"Q\" Smith"}` + "\n" +
+	`{"browsers":["Opera"],"email":"x@y","name":"no"}` + "\n" +
+	`{"browsers":["MSIE 9.0","Android\t5"],"company":"Muxo","country":"Иран","email":"d@@e","name":"Иван"}`
+
+func searchOutput(t *testing.T, s *Searcher, input string) string {
+	out := new(bytes.Buffer)
+	if err := s.Search(strings.NewReader(input), out, androidAndMSIE); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestOutputJSON(t *testing.T) {
+	all := []OutputField{OutIndex, OutName, OutEmail, OutCompany, OutCountry, OutBrowsers}
+	got := searchOutput(t, &Searcher{Output: Output{Format: FormatJSON, Fields: all, Email: EmailPlain}}, outputInput)
+
+	type record struct {
+		Index    *int     `json:"index"`
+		Name     string   `json:"name"`
+		Email    string   `json:"email"`
+		Company  string   `json:"company"`
+		Country  string   `json:"country"`
+		Browsers []string `json:"browsers"`
+		Total    *int     `json:"total_unique_browsers"`
+	}
+	zero, two, four := 0, 2, 4
+	expected := []record{
+		{Index: &zero, Name: `Jo "Q" Smith`, Email: "a@b.c", Company: "Acme, Inc.", Country: "Peru", Browsers: []string{"Android 4.0", "MSIE 8.0"}},
+		{Index: &two, Name: "Иван", Email: "d@@e", Company: "Muxo", Country: "Иран", Browsers: []string{"MSIE 9.0", "Android\t5"}},
+		{Total: &four},
+	}
+
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("got %d lines, expected %d:\n%s", len(lines), len(expected), got)
+	}
+	for i, line := range lines {
+		r := record{}
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("line %d: %s\n%s", i, err, line)
+		}
+		if !reflect.DeepEqual(r, expected[i]) {
+			t.Errorf("line %d: got %+v, expected %+v", i, r, expected[i])
+		}
+	}
+}
+
+func TestOutputCSV(t *testing.T) {
+	s := &Searcher{Output: Output{Format: FormatCSV, Fields: []OutputField{OutName, OutCompany, OutEmail, OutBrowsers, OutIndex}}}
+	records, err := csv.NewReader(strings.NewReader(searchOutput(t, s, outputInput))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"name", "company", "email", "browsers", "index"},
+		{`Jo "Q" Smith`, "Acme, Inc.", "a [at] b.c", "Android 4.0|MSIE 8.0", "0"},
+		{"Иван", "Muxo", "d [at]  [at] e", "MSIE 9.0|Android\t5", "2"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("got\n%q\nexpected\n%q", records, expected)
+	}
+
+	// разделитель внутри браузера не должен делить его на два
+	s.Output.Fields = []OutputField{OutBrowsers}
+	got := searchOutput(t, s, `{"browsers":["MSIE|8","Android \\ 4"],"email":"a@b"}`)
+	if expected := "browsers\n" + `MSIE\|8|Android \\ 4` + "\n"; got != expected {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+}
+
+func TestOutputEmail(t *testing.T) {
+	sum := sha256.Sum256([]byte("a@b.c"))
+	hashed := hex.EncodeToString(sum[:])
+	cases := []struct {
+		email    EmailPolicy
+		expected string
+	}{
+		{EmailObfuscated, "[0] Jo \"Q\" Smith <a [at] b.c>\n"},
+		{EmailPlain, "[0] Jo \"Q\" Smith <a@b.c>\n"},
+		{EmailHashed, "[0] Jo \"Q\" Smith <" + hashed + ">\n"},
+	}
+	for _, c := range cases {
+		got := searchOutput(t, &Searcher{Output: Output{Email: c.email}}, outputInput)
+		if !strings.HasPrefix(got, "found users:\n"+c.expected) {
+			t.Errorf("[email %d] got\n%s", c.email, got)
+		}
+	}
+}
+
+// TestOutputParallel все пути поиска печатают одинаково
+func TestOutputParallel(t *testing.T) {
+	data := generateUsers(t, datagen.Config{Users: 3000, Seed: 5, Adversarial: 0.2})
+	for _, output := range []Output{
+		{Format: FormatJSON, Fields: []OutputField{OutIndex, OutName, OutEmail, OutBrowsers}, Email: EmailHashed},
+		{Format: FormatCSV, Fields: []OutputField{OutBrowsers, OutCountry, OutName}},
+	} {
+		expected := searchOutput(t, &Searcher{Output: output}, string(data))
+		if got := searchOutput(t, &Searcher{Workers: 4, Output: output}, string(data)); got != expected {
+			t.Errorf("[format %d] parallel differs\nGot:\n%v\nExpected:\n%v", output.Format, got, expected)
+		}
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	fields, err := ParseFields("index, name,browsers")
+	if err != nil || !reflect.DeepEqual(fields, []OutputField{OutIndex, OutName, OutBrowsers}) {
+		t.Errorf("got %v %v", fields, err)
+	}
+	if _, err := ParseFields("name,phone"); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestOutputNoAllocs(t *testing.T) {
+	v := &userView{Name: []byte("Jo, \"Q\""), Email: []byte("a@b.c"), Browsers: [][]byte{[]byte("Android"), []byte("MSIE")}}
+	for _, output := range []Output{
+		{},
+		{Format: FormatJSON, Fields: []OutputField{OutIndex, OutName, OutEmail, OutBrowsers}, Email: EmailHashed},
+		{Format: FormatCSV, Fields: []OutputField{OutIndex, OutName, OutEmail, OutBrowsers}},
+	} {
+		w := newOutWriter(&bytes.Buffer{}, output)
+		w.user(0, v)
+		if allocs := testing.AllocsPerRun(100, func() { w.user(12345, v) }); allocs != 0 {
+			t.Errorf("[format %d] %v allocs per user", output.Format, allocs)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// кусок меньше этого резать на воркеры нет смысла
+var minChunkSize = 64 << 10
+
+const setShards = 64
+
+// shardedSet множество браузеров, в которое пишут все воркеры: блокировка на шард, а не на всё
+type shardedSet struct {
+	shards [setShards]struct {
+		sync.Mutex
+		m map[string]struct{}
+	}
+}
+
+func newShardedSet() *shardedSet {
+	s := &shardedSet{}
+	for i := range s.shards {
+		s.shards[i].m = make(map[string]struct{})
+	}
+	return s
+}
+
+func (s *shardedSet) add(browser []byte) {
+	// fnv-1a
+	h := uint32(2166136261)
+	for _, c := range browser {
+		h ^= uint32(c)
+		h *= 16777619
+	}
+	shard := &s.shards[h%setShards]
+	shard.Lock()
+	if _, seen := shard.m[string(browser)]; !seen {
+		shard.m[string(browser)] = struct{}{}
+	}
+	shard.Unlock()
+}
+
+func (s *shardedSet) len() int {
+	n := 0
+	for i := range s.shards {
+		s.shards[i].Lock()
+		n += len(s.shards[i].m)
+		s.shards[i].Unlock()
+	}
+	return n
+}
+
+// chunkResult что нашлось в куске. Номера строк локальные, сдвиг известен только когда
+// посчитаны все предыдущие куски
+type chunkResult struct {
+	lines   int
+	matches []int
+	users   []userView // разобранные совпадения, срезы указывают в data или в копии от unescape
+	err     error
+	errLine int
+	done    chan struct{}
+}
+
+// searchBytes режет data на куски по границам строк, разбирает их в s.Workers горутин
+// и выводит совпадения в исходном порядке строк по мере готовности кусков.
+// Возвращается только после того, как все воркеры вышли: data может быть mmap,
+// который вызывающий сразу освободит
+func (s *Searcher) searchBytes(ctx context.Context, data []byte, out io.Writer, q Query) error {
+	workers := s.Workers
+	if workers <= 1 {
+		workers = 1
+	}
+	chunks := splitChunks(data, workers*4)
+	return s.searchChunks(ctx, func() ([]byte, error) {
+		if len(chunks) == 0 {
+			return nil, io.EOF
+		}
+		chunk := chunks[0]
+		chunks = chunks[1:]
+		return chunk, nil
+	}, out, q)
+}
+
+// searchStream то же, что searchBytes, но читает r кусками по minChunkSize по мере разбора:
+// в памяти одновременно лежит лишь несколько кусков на воркер, каким бы большим ни был r
+func (s *Searcher) searchStream(ctx context.Context, r io.Reader, out io.Writer, q Query) error {
+	cr := &chunkReader{r: r, size: minChunkSize}
+	return s.searchChunks(ctx, cr.next, out, q)
+}
+
+// chunkJob кусок в работе. readErr - кусок не прочитан, дальше данных нет
+type chunkJob struct {
+	data    []byte
+	result  chunkResult
+	readErr error
+}
+
+// searchChunks разбирает куски из next, пока он не вернёт io.EOF. next зовётся из одной горутины
+func (s *Searcher) searchChunks(ctx context.Context, next func() ([]byte, error), out io.Writer, q Query) error {
+	workers := s.Workers
+	if workers <= 1 {
+		workers = 1
+	}
+	stats, err := s.newStats(workers)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+	jobs := make(chan *chunkJob)
+	// ordered куски в порядке входа; его буфер ограничивает, сколько кусков читается наперёд
+	ordered := make(chan *chunkJob, workers*2)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(ordered)
+		defer close(jobs)
+		for {
+			data, err := next()
+			if err == io.EOF {
+				return
+			}
+			j := &chunkJob{data: data, readErr: err}
+			j.result.done = make(chan struct{})
+			select {
+			case ordered <- j:
+			case <-stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+			select {
+			case jobs <- j:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(seen browserSet) {
+			defer wg.Done()
+			m := newLineMatcher(q, s.Unique)
+			for j := range jobs {
+				processChunk(ctx, stop, m, j.data, seen, &j.result)
+				close(j.result.done)
+			}
+		}(stats[w])
+	}
+
+	w := newOutWriter(out, s.Output)
+	if err := w.header(); err != nil {
+		return err
+	}
+	base := 0
+	for job := range ordered {
+		if job.readErr != nil {
+			return job.readErr
+		}
+		r := &job.result
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if r.err == errStopped {
+			return ctx.Err()
+		}
+		if r.err != nil {
+			return fmt.Errorf("line %d: %w", base+r.errLine, r.err)
+		}
+		for j, line := range r.matches {
+			if err := w.user(base+line, &r.users[j]); err != nil {
+				return err
+			}
+		}
+		base += r.lines
+	}
+
+	// все куски готовы, а воркер добавляет браузеры до close(done): счётчики больше не меняются
+	return w.footer(mergeStats(stats))
+}
+
+// errStopped кусок брошен: поиск уже закончился ошибкой или отменён
+var errStopped = errors.New("search stopped")
+
+func processChunk(ctx context.Context, stop <-chan struct{}, m *lineMatcher, chunk []byte, seen browserSet, r *chunkResult) {
+	for len(chunk) > 0 {
+		if r.lines%ctxCheckLines == 0 {
+			select {
+			case <-stop:
+				r.err = errStopped
+				return
+			case <-ctx.Done():
+				r.err = errStopped
+				return
+			default:
+			}
+		}
+		line := chunk
+		if idx := bytes.IndexByte(chunk, '\n'); idx >= 0 {
+			line, chunk = chunk[:idx], chunk[idx+1:]
+		} else {
+			chunk = nil
+		}
+		line = dropCR(line)
+
+		match, err := m.match(line, seen)
+		if err != nil {
+			r.err, r.errLine = err, r.lines
+			return
+		}
+		if match {
+			r.matches = append(r.matches, r.lines)
+			r.users = append(r.users, m.view.clone())
+		}
+		r.lines++
+	}
+}
+
+// splitChunks режет data примерно на n кусков, каждый кончается переводом строки (кроме последнего)
+func splitChunks(data []byte, n int) [][]byte {
+	size := len(data) / n
+	if size < minChunkSize {
+		size = minChunkSize
+	}
+	chunks := [][]byte{}
+	for len(data) > 0 {
+		end := size
+		if end >= len(data) {
+			end = len(data)
+		} else if idx := bytes.IndexByte(data[end:], '\n'); idx >= 0 {
+			end += idx + 1
+		} else {
+			end = len(data)
+		}
+		chunks = append(chunks, data[:end])
+		data = data[end:]
+	}
+	return chunks
+}
+
+// chunkReader режет поток на куски примерно по size байт: как только прочитано size байт,
+// кусок кончается на последнем переводе строки в них. Строка длиннее size целиком попадает в один кусок
+type chunkReader struct {
+	r    io.Reader
+	size int
+	// rest начало следующего куска: хвост прочитанного после последнего перевода строки
+	rest []byte
+	err  error
+}
+
+func (c *chunkReader) next() ([]byte, error) {
+	buf := make([]byte, len(c.rest), len(c.rest)+c.size)
+	copy(buf, c.rest)
+	c.rest = nil
+	// scanned сколько байт buf уже проверено: перевода строки в них нет
+	scanned := 0
+	for {
+		if len(buf) >= c.size {
+			if idx := bytes.LastIndexByte(buf[scanned:], '\n'); idx >= 0 {
+				end := scanned + idx + 1
+				c.rest = buf[end:]
+				return buf[:end], nil
+			}
+			scanned = len(buf)
+		}
+		if c.err != nil {
+			break
+		}
+		if len(buf) == cap(buf) {
+			buf = append(buf, make([]byte, c.size)...)[:len(buf)]
+		}
+		var n int
+		n, c.err = c.r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+	}
+	// вход кончился: сначала отдаём то, что успели прочитать, потом ошибку.
+	// При ошибке чтения строка без перевода строки оборвана, её разбор только спрятал бы причину
+	if c.err != io.EOF {
+		buf = buf[:bytes.LastIndexByte(buf, '\n')+1]
+	}
+	if len(buf) > 0 {
+		return buf, nil
+	}
+	return nil, c.err
+}
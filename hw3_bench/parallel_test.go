@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSearchParallel(t *testing.T) {
+	slowOut := new(bytes.Buffer)
+	SlowSearch(slowOut)
+	expected := slowOut.String()
+
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(size int) { minChunkSize = size }(minChunkSize)
+	// мелкие куски, чтобы их было больше, чем воркеров, и границы попадали куда угодно
+	for _, size := range []int{1, 100, 4096, 1 << 20} {
+		minChunkSize = size
+		for _, workers := range []int{2, 3, 8} {
+			out := new(bytes.Buffer)
+			if err := (&Searcher{Workers: workers}).SearchFile(filePath, out, androidAndMSIE); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != expected {
+				t.Errorf("[chunk %d, workers %d] results not match\nGot:\n%v\nExpected:\n%v", size, workers, got, expected)
+			}
+
+			// поток режется на куски по мере чтения, читаем его мелкими кусками
+			out.Reset()
+			if err := (&Searcher{Workers: workers}).Search(iotest.HalfReader(bytes.NewReader(data)), out, androidAndMSIE); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != expected {
+				t.Errorf("[stream chunk %d, workers %d] results not match\nGot:\n%v\nExpected:\n%v", size, workers, got, expected)
+			}
+		}
+	}
+}
+
+func TestChunkReader(t *testing.T) {
+	data := "a\nbb\n\nccc\nlong line\nd"
+	cr := &chunkReader{r: iotest.OneByteReader(strings.NewReader(data)), size: 3}
+	chunks := []string{}
+	for {
+		chunk, err := cr.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, string(chunk))
+	}
+	// кусок режется по последнему переводу строки, как только набралось size байт
+	expected := []string{"a\n", "bb\n", "\n", "ccc\n", "long line\n", "d"}
+	if fmt.Sprintf("%q", chunks) != fmt.Sprintf("%q", expected) {
+		t.Errorf("expected %q, got %q", expected, chunks)
+	}
+
+	// прочитанные до ошибки целые строки отдаются, оборванная выбрасывается, потом сама ошибка
+	cr = &chunkReader{r: iotest.TimeoutReader(strings.NewReader(data)), size: 100}
+	if chunk, err := cr.next(); err != nil || string(chunk) != data[:len(data)-1] {
+		t.Errorf("expected data before error, got %q, %v", chunk, err)
+	}
+	if _, err := cr.next(); err != iotest.ErrTimeout {
+		t.Errorf("expected read error, got %v", err)
+	}
+}
+
+func TestSplitChunks(t *testing.T) {
+	defer func(size int) { minChunkSize = size }(minChunkSize)
+	minChunkSize = 1
+
+	data := []byte("a\nbb\n\nccc\nd")
+	chunks := splitChunks(data, 3)
+	if joined := bytes.Join(chunks, nil); !bytes.Equal(joined, data) {
+		t.Fatalf("chunks must cover data, got %q", joined)
+	}
+	for i, c := range chunks[:len(chunks)-1] {
+		if c[len(c)-1] != '\n' {
+			t.Errorf("chunk %d %q must end with newline", i, c)
+		}
+	}
+
+	r := chunkResult{}
+	processChunk(context.Background(), nil, newLineMatcher(androidAndMSIE, UniqueRaw), []byte("{}\r\n{}\n{}"), newShardedSet(), &r)
+	if r.err != nil || r.lines != 3 {
+		t.Errorf("expected 3 lines, got %d (%v)", r.lines, r.err)
+	}
+}
+
+func TestSearchParallelError(t *testing.T) {
+	data := []byte("{}\n{}\n{\"browsers\":[\"MSIE Android\"]\n")
+	err := (&Searcher{Workers: 2}).searchBytes(context.Background(), data, ioutil.Discard, androidAndMSIE)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("expected error on line 2, got %v", err)
+	}
+	if errors.Unwrap(err) == nil {
+		t.Errorf("parse error must be wrapped, got %v", err)
+	}
+
+	err = (&Searcher{}).Search(bytes.NewReader(data), ioutil.Discard, androidAndMSIE)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") || errors.Unwrap(err) == nil {
+		t.Errorf("expected wrapped error on line 2, got %v", err)
+	}
+}
+
+func BenchmarkFastParallel(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		FastSearchParallel(ioutil.Discard)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import "bytes"
+
+// acMinPatterns с какого числа литералов один проход Aho-Corasick быстрее, чем bytes.Contains
+// на каждый: bytes.Contains ищет первый байт через SIMD и на паре литералов выигрывает втрое.
+// По BenchmarkPrefilter на 4 литералах ещё впереди bytes.Contains, на 8 - уже автомат.
+// Переменная - чтобы тесты проверяли оба пути
+var acMinPatterns = 6
+
+type pfOp int
+
+const (
+	pfTrue pfOp = iota
+	pfLiteral
+	pfAnd
+	pfOr
+)
+
+// pfExpr что должно встретиться в сырой строке, чтобы она могла подойти под запрос
+type pfExpr struct {
+	op       pfOp
+	pattern  int
+	children []pfExpr
+}
+
+// escapePattern в строке с экранированием значение может быть записано как \u0041ndroid,
+// такую строку по сырым байтам отбрасывать нельзя
+const escapePattern = 0
+
+// prefilter отбрасывает строки до разбора json по литералам всех условий запроса
+type prefilter struct {
+	patterns [][]byte
+	ac       *ahoCorasick // nil - литералы ищутся по одному и только когда понадобятся
+	query    pfExpr
+	browsers pfExpr
+
+	// состояние текущей строки: 0 - не искали, 1 - есть, -1 - нет
+	line  []byte
+	state []int8
+	found []bool
+}
+
+func newPrefilter(q Query, browserTerms []*term) *prefilter {
+	p := &prefilter{patterns: [][]byte{{'\\'}}}
+	p.query = q.literals(p)
+	browsers := make([]Query, len(browserTerms))
+	for i, t := range browserTerms {
+		browsers[i] = t
+	}
+	p.browsers = or(browsers).literals(p)
+
+	if len(p.patterns)-1 >= acMinPatterns {
+		p.ac = newAhoCorasick(p.patterns)
+	}
+	p.state = make([]int8, len(p.patterns))
+	p.found = make([]bool, len(p.patterns))
+	return p
+}
+
+// pattern номер литерала, одинаковые литералы разных условий ищутся один раз
+func (p *prefilter) pattern(literal []byte) pfExpr {
+	for i, known := range p.patterns {
+		if bytes.Equal(known, literal) {
+			return pfExpr{op: pfLiteral, pattern: i}
+		}
+	}
+	p.patterns = append(p.patterns, literal)
+	return pfExpr{op: pfLiteral, pattern: len(p.patterns) - 1}
+}
+
+func (p *prefilter) reset(line []byte) {
+	p.line = line
+	if p.ac == nil {
+		for i := range p.state {
+			p.state[i] = 0
+		}
+		return
+	}
+	for i := range p.found {
+		p.found[i] = false
+	}
+	p.ac.find(line, p.found)
+	for i, found := range p.found {
+		p.state[i] = -1
+		if found {
+			p.state[i] = 1
+		}
+	}
+}
+
+func (p *prefilter) has(pattern int) bool {
+	if p.state[pattern] == 0 {
+		p.state[pattern] = -1
+		if bytes.Contains(p.line, p.patterns[pattern]) {
+			p.state[pattern] = 1
+		}
+	}
+	return p.state[pattern] > 0
+}
+
+func (p *prefilter) mayMatch(e *pfExpr) bool {
+	switch e.op {
+	case pfLiteral:
+		return p.has(e.pattern) || p.has(escapePattern)
+	case pfAnd:
+		for i := range e.children {
+			if !p.mayMatch(&e.children[i]) {
+				return false
+			}
+		}
+		return true
+	case pfOr:
+		for i := range e.children {
+			if p.mayMatch(&e.children[i]) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// pfAll все children должны выполниться. Условия, которые не проверить, и повторы выбрасываются
+func pfAll(children []pfExpr) pfExpr {
+	checked := []pfExpr{}
+	seen := map[int]bool{}
+	for _, c := range children {
+		if c.op == pfTrue || c.op == pfLiteral && seen[c.pattern] {
+			continue
+		}
+		if c.op == pfLiteral {
+			seen[c.pattern] = true
+		}
+		checked = append(checked, c)
+	}
+	switch len(checked) {
+	case 0:
+		return pfExpr{op: pfTrue}
+	case 1:
+		return checked[0]
+	}
+	return pfExpr{op: pfAnd, children: checked}
+}
+
+// pfAny хотя бы одно из children. Если хоть одно не проверить, не проверить и всё
+func pfAny(children []pfExpr) pfExpr {
+	for _, c := range children {
+		if c.op == pfTrue {
+			return c
+		}
+	}
+	if len(children) == 1 {
+		return children[0]
+	}
+	return pfExpr{op: pfOr, children: children}
+}
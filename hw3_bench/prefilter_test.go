@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/moguchev/coursera_go/hw3_bench/datagen"
+)
+
+func TestAhoCorasick(t *testing.T) {
+	sets := [][]string{
+		{"he", "she", "his", "hers"},
+		{"a", "aa", "aaa", "b"},
+		{"Android", "MSIE", "\\", "Mozilla/5.0", "droid"},
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for _, set := range sets {
+		patterns := make([][]byte, len(set))
+		alphabet := []byte{}
+		for i, p := range set {
+			patterns[i] = []byte(p)
+			alphabet = append(alphabet, p...)
+		}
+		ac := newAhoCorasick(patterns)
+		for n := 0; n < 2000; n++ {
+			line := make([]byte, rnd.Intn(40))
+			for i := range line {
+				// в основном буквы шаблонов, чтобы они часто встречались и перекрывались
+				if rnd.Intn(4) == 0 {
+					line[i] = byte(rnd.Intn(256))
+				} else {
+					line[i] = alphabet[rnd.Intn(len(alphabet))]
+				}
+			}
+			found := make([]bool, len(patterns))
+			count := ac.find(line, found)
+			expectedCount := 0
+			for i, p := range patterns {
+				expected := bytes.Contains(line, p)
+				if expected {
+					expectedCount++
+				}
+				if found[i] != expected {
+					t.Fatalf("%q in %q: got %v, expected %v", p, line, found[i], expected)
+				}
+			}
+			if count != expectedCount {
+				t.Fatalf("%q: got count %d, expected %d", line, count, expectedCount)
+			}
+		}
+	}
+
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	if newAhoCorasick([][]byte{all}) != nil {
+		t.Error("expected nil automaton for 256 distinct bytes")
+	}
+}
+
+func TestPrefilterModes(t *testing.T) {
+	data := generateUsers(t, datagen.Config{Users: 3000, Seed: 11, Adversarial: 0.1})
+	queries := indexQueries(t)
+	queries["many literals"] = Or(
+		And(Contains(FieldBrowser, "Android"), Contains(FieldBrowser, "MSIE")),
+		Equals(FieldCountry, "Peru"), Equals(FieldEmailDomain, "Muxo.edu"), Contains(FieldBrowser, "Opera Mini"),
+		Contains(FieldBrowserFamily, "IE"),
+	)
+	queries["empty or"] = Or()
+
+	defer func(n int) { acMinPatterns = n }(acMinPatterns)
+	for name, q := range queries {
+		outs := []string{}
+		for _, min := range []int{1, 1 << 20} {
+			acMinPatterns = min
+			out := new(bytes.Buffer)
+			if err := (&Searcher{}).Search(bytes.NewReader(data), out, q); err != nil {
+				t.Fatal(err)
+			}
+			outs = append(outs, out.String())
+		}
+		if outs[0] != outs[1] {
+			t.Errorf("[%s] Aho-Corasick and bytes.Contains differ\n%s\n%s", name, outs[0], outs[1])
+		}
+	}
+}
+
+func TestPrefilterExpr(t *testing.T) {
+	q := Or(And(Contains(FieldBrowser, "Android"), Contains(FieldBrowser, "MSIE")), Not(Contains(FieldCompany, "x")))
+	if e := newPrefilter(q, nil).query; e.op != pfTrue {
+		t.Errorf("or with not must be unchecked, got %+v", e)
+	}
+
+	p := newPrefilter(And(Contains(FieldBrowser, "Android"), Contains(FieldCompany, "Android"), Equals(FieldCountry, "a\"b")), nil)
+	// одинаковые литералы ищутся один раз, а строку с кавычкой по сырым байтам не проверить
+	if len(p.patterns) != 2 || p.query.op != pfLiteral {
+		t.Errorf("got patterns %q, expr %+v", p.patterns, p.query)
+	}
+	for line, expected := range map[string]bool{
+		`{"browsers":["Android"]}`:      true,
+		`{"browsers":["MSIE"]}`:         false,
+		`{"browsers":["\u0041ndroid"]}`: true,
+	} {
+		p.reset([]byte(line))
+		if got := p.mayMatch(&p.query); got != expected {
+			t.Errorf("%s: got %v", line, got)
+		}
+	}
+}
+
+// BenchmarkPrefilter один проход Aho-Corasick против bytes.Contains на каждый литерал
+// на запросе из n литералов, которых в строках почти нет: худший случай для bytes.Contains
+func BenchmarkPrefilter(b *testing.B) {
+	data := generateUsers(b, datagen.Config{Users: 2000, Seed: 1})
+	lines := bytes.Split(data, []byte("\n"))
+	words := []string{"Android 9", "MSIE 4", "Lynx", "Konqueror", "NetFront", "Dolphin", "Silk", "Midori",
+		"Epiphany", "SeaMonkey", "K-Meleon", "Camino", "Iceweasel", "Maxthon", "Sleipnir", "Vivaldi"}
+
+	defer func(n int) { acMinPatterns = n }(acMinPatterns)
+	for _, n := range []int{1, 2, 4, 8, 16} {
+		qs := []Query{}
+		for _, w := range words[:n] {
+			qs = append(qs, Contains(FieldBrowser, w))
+		}
+		q := Or(qs...)
+		for _, mode := range []struct {
+			name string
+			min  int
+		}{{"contains", 1 << 20}, {"ahocorasick", 1}} {
+			acMinPatterns = mode.min
+			p := newPrefilter(q, nil)
+			b.Run(fmt.Sprintf("%s/%d", mode.name, n), func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					for _, line := range lines {
+						p.reset(line)
+						p.mayMatch(&p.query)
+					}
+				}
+			})
+		}
+	}
+}
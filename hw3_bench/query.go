@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/moguchev/coursera_go/hw3_bench/models"
+)
+
+// Field поле пользователя, по которому идёт отбор
+type Field int
+
+const (
+	// FieldBrowser условие выполняется, если подходит хотя бы один из browsers
+	FieldBrowser Field = iota
+	FieldCompany
+	FieldCountry
+	// FieldEmailDomain часть email после @
+	FieldEmailDomain
+	// FieldBrowserFamily и дальше - части разобранных browsers (см. ParseUserAgent),
+	// условие выполняется, если подходит хотя бы один браузер
+	FieldBrowserFamily
+	FieldBrowserVersion
+	FieldOS
+	FieldDevice
+)
+
+// perBrowser поле считается отдельно для каждого браузера пользователя
+func (f Field) perBrowser() bool {
+	return f == FieldBrowser || f >= FieldBrowserFamily
+}
+
+// browserValue значение поля для одного браузера
+func (f Field) browserValue(browser []byte) []byte {
+	if f == FieldBrowser {
+		return browser
+	}
+	e := lookupUserAgent(browser)
+	switch f {
+	case FieldBrowserFamily:
+		return e.family
+	case FieldBrowserVersion:
+		return e.version
+	case FieldOS:
+		return e.os
+	default:
+		return e.device
+	}
+}
+
+// Query условие отбора пользователей, собирается из Equals/Contains/Regexp и And/Or/Not
+type Query interface {
+	Match(u *models.User) bool
+	// matchView то же, что Match, но по разобранной без аллокаций строке
+	matchView(v *userView) bool
+	// literals что обязано встретиться в сырой строке, литералы регистрируются в p
+	literals(p *prefilter) pfExpr
+	// browserTerms условия на браузеры: по ним считается "Total unique browsers"
+	browserTerms() []*term
+	// candidates строки, которые могут подойти, по индексу. false - индекс тут не поможет
+	candidates(ix *Index) ([]uint32, bool)
+}
+
+type termOp int
+
+const (
+	opEquals termOp = iota
+	opContains
+	opRegexp
+)
+
+type term struct {
+	field Field
+	op    termOp
+	value string
+	bytes []byte
+	re    *regexp.Regexp
+	// что обязано встретиться в сырой строке, nil - проверить нельзя
+	literal []byte
+}
+
+// Equals поле совпадает со значением целиком
+func Equals(field Field, value string) Query {
+	return &term{field: field, op: opEquals, value: value, bytes: []byte(value), literal: jsonLiteral(field, value)}
+}
+
+// Contains поле содержит подстроку
+func Contains(field Field, substr string) Query {
+	return &term{field: field, op: opContains, value: substr, bytes: []byte(substr), literal: jsonLiteral(field, substr)}
+}
+
+// Regexp поле подходит под регулярное выражение
+func Regexp(field Field, expr string) (Query, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	prefix, _ := re.LiteralPrefix()
+	return &term{field: field, op: opRegexp, value: expr, re: re, literal: jsonLiteral(field, prefix)}, nil
+}
+
+// jsonLiteral строку можно искать в сыром json как есть, только если в ней нечего экранировать.
+// Разобранных из браузера значений ("IE" из "MSIE 6.0") в сырой строке может и не быть
+func jsonLiteral(field Field, s string) []byte {
+	if field >= FieldBrowserFamily || s == "" || strings.ContainsAny(s, `"\`) {
+		return nil
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 {
+			return nil
+		}
+	}
+	return []byte(s)
+}
+
+func (t *term) matchString(s string) bool {
+	switch t.op {
+	case opEquals:
+		return s == t.value
+	case opContains:
+		return strings.Contains(s, t.value)
+	default:
+		return t.re.MatchString(s)
+	}
+}
+
+func (t *term) matchBytes(b []byte) bool {
+	switch t.op {
+	case opEquals:
+		return bytes.Equal(b, t.bytes)
+	case opContains:
+		return bytes.Contains(b, t.bytes)
+	default:
+		return t.re.Match(b)
+	}
+}
+
+func (t *term) Match(u *models.User) bool {
+	if t.field.perBrowser() {
+		for _, browser := range u.Browsers {
+			if t.matchBrowser([]byte(browser)) {
+				return true
+			}
+		}
+		return false
+	}
+	switch t.field {
+	case FieldCompany:
+		return t.matchString(u.Company)
+	case FieldCountry:
+		return t.matchString(u.Country)
+	default:
+		return t.matchString(emailDomain(u.Email))
+	}
+}
+
+func (t *term) matchView(v *userView) bool {
+	if t.field.perBrowser() {
+		for _, browser := range v.Browsers {
+			if t.matchBrowser(browser) {
+				return true
+			}
+		}
+		return false
+	}
+	switch t.field {
+	case FieldCompany:
+		return t.matchBytes(v.Company)
+	case FieldCountry:
+		return t.matchBytes(v.Country)
+	default:
+		return t.matchBytes(v.Email[bytes.LastIndexByte(v.Email, '@')+1:])
+	}
+}
+
+// matchBrowser подходит ли один браузер под условие на FieldBrowser или его части
+func (t *term) matchBrowser(browser []byte) bool {
+	return t.matchBytes(t.field.browserValue(browser))
+}
+
+func (t *term) literals(p *prefilter) pfExpr {
+	if t.literal == nil {
+		return pfExpr{op: pfTrue}
+	}
+	return p.pattern(t.literal)
+}
+
+func (t *term) browserTerms() []*term {
+	if t.field.perBrowser() {
+		return []*term{t}
+	}
+	return nil
+}
+
+func (t *term) candidates(ix *Index) ([]uint32, bool) {
+	if t.field != FieldBrowser {
+		return nil, false
+	}
+	switch t.op {
+	case opContains:
+		if !indexable(t.value) {
+			return nil, false
+		}
+		return ix.linesContaining(t.value), true
+	case opEquals:
+		// браузер целиком совпадает со значением - значит, в нём есть все токены значения
+		tokens := tokenize(t.bytes)
+		if len(tokens) == 0 {
+			return nil, false
+		}
+		lines := ix.lines(string(tokens[0]))
+		for _, token := range tokens[1:] {
+			lines = intersectLines(lines, ix.lines(string(token)))
+		}
+		return lines, true
+	default:
+		return nil, false
+	}
+}
+
+func emailDomain(email string) string {
+	return email[strings.LastIndexByte(email, '@')+1:]
+}
+
+type and []Query
+
+// And все условия выполняются
+func And(qs ...Query) Query {
+	return and(qs)
+}
+
+func (a and) Match(u *models.User) bool {
+	for _, q := range a {
+		if !q.Match(u) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a and) matchView(v *userView) bool {
+	for _, q := range a {
+		if !q.matchView(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a and) literals(p *prefilter) pfExpr {
+	children := make([]pfExpr, len(a))
+	for i, q := range a {
+		children[i] = q.literals(p)
+	}
+	return pfAll(children)
+}
+
+func (a and) browserTerms() []*term {
+	return collectTerms(a)
+}
+
+// candidates пересечение по тем условиям, где индекс помогает, остальные проверятся при разборе
+func (a and) candidates(ix *Index) ([]uint32, bool) {
+	var lines []uint32
+	found := false
+	for _, q := range a {
+		qLines, ok := q.candidates(ix)
+		if !ok {
+			continue
+		}
+		if found {
+			lines = intersectLines(lines, qLines)
+		} else {
+			lines, found = qLines, true
+		}
+	}
+	return lines, found
+}
+
+type or []Query
+
+// Or выполняется хотя бы одно условие
+func Or(qs ...Query) Query {
+	return or(qs)
+}
+
+func (o or) Match(u *models.User) bool {
+	for _, q := range o {
+		if q.Match(u) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o or) matchView(v *userView) bool {
+	for _, q := range o {
+		if q.matchView(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o or) literals(p *prefilter) pfExpr {
+	children := make([]pfExpr, len(o))
+	for i, q := range o {
+		children[i] = q.literals(p)
+	}
+	return pfAny(children)
+}
+
+func (o or) browserTerms() []*term {
+	return collectTerms(o)
+}
+
+func (o or) candidates(ix *Index) ([]uint32, bool) {
+	var lines []uint32
+	for _, q := range o {
+		qLines, ok := q.candidates(ix)
+		if !ok {
+			return nil, false
+		}
+		lines = unionLines(lines, qLines)
+	}
+	return lines, len(o) > 0
+}
+
+type not struct {
+	q Query
+}
+
+// Not условие не выполняется
+func Not(q Query) Query {
+	return not{q}
+}
+
+func (n not) Match(u *models.User) bool {
+	return !n.q.Match(u)
+}
+
+func (n not) matchView(v *userView) bool {
+	return !n.q.matchView(v)
+}
+
+// literals по сырой строке отрицание не проверить
+func (n not) literals(p *prefilter) pfExpr {
+	return pfExpr{op: pfTrue}
+}
+
+func (n not) browserTerms() []*term {
+	return n.q.browserTerms()
+}
+
+func (n not) candidates(ix *Index) ([]uint32, bool) {
+	return nil, false
+}
+
+func collectTerms(qs []Query) []*term {
+	terms := []*term{}
+	for _, q := range qs {
+		terms = append(terms, q.browserTerms()...)
+	}
+	return terms
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/moguchev/coursera_go/hw3_bench/models"
+)
+
+// referenceSearch то же, что FastSearchQuery, но без префильтра и userView
+func referenceSearch(t *testing.T, q Query) string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	terms := q.browserTerms()
+	seen := map[string]bool{}
+	res := "found users:\n"
+	scanner := bufio.NewScanner(file)
+	for i := 0; scanner.Scan(); i++ {
+		user := models.User{}
+		if err := json.Unmarshal(scanner.Bytes(), &user); err != nil {
+			t.Fatal(err)
+		}
+		for _, browser := range user.Browsers {
+			for _, term := range terms {
+				if term.matchBrowser([]byte(browser)) {
+					seen[browser] = true
+				}
+			}
+		}
+		if q.Match(&user) {
+			res += fmt.Sprintf("[%d] %s <%s>\n", i, user.Name, strings.Replace(user.Email, "@", " [at] ", -1))
+		}
+	}
+	return res + fmt.Sprintf("\nTotal unique browsers %d\n", len(seen))
+}
+
+func mustRegexp(t *testing.T, field Field, expr string) Query {
+	q, err := Regexp(field, expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestQueryMatch(t *testing.T) {
+	user := &models.User{
+		Browsers: []string{"Mozilla/5.0 (Linux; Android 4.4.2)", "Opera/9.80"},
+		Company:  "Flashpoint",
+		Country:  "Dominican Republic",
+		Email:    "JonathanMorris@Muxo.edu",
+	}
+
+	cases := []struct {
+		q     Query
+		match bool
+	}{
+		{Equals(FieldCompany, "Flashpoint"), true},
+		{Equals(FieldCompany, "Flash"), false},
+		{Contains(FieldCountry, "Republic"), true},
+		{Equals(FieldEmailDomain, "Muxo.edu"), true},
+		{Equals(FieldBrowser, "Opera/9.80"), true},
+		{mustRegexp(t, FieldBrowser, `Android \d\.\d`), true},
+		{mustRegexp(t, FieldEmailDomain, `\.com$`), false},
+		{And(Contains(FieldBrowser, "Android"), Contains(FieldBrowser, "MSIE")), false},
+		{Or(Contains(FieldBrowser, "MSIE"), Contains(FieldBrowser, "Opera")), true},
+		{Not(Contains(FieldBrowser, "MSIE")), true},
+		{And(Not(Equals(FieldCountry, "Peru")), Contains(FieldEmailDomain, "Muxo")), true},
+	}
+	for i, c := range cases {
+		if got := c.q.Match(user); got != c.match {
+			t.Errorf("[%d] expected %v, got %v", i, c.match, got)
+		}
+	}
+
+	if _, err := Regexp(FieldBrowser, "("); err == nil {
+		t.Error("bad regexp must fail")
+	}
+}
+
+func TestFastSearchQuery(t *testing.T) {
+	queries := map[string]Query{
+		"android and msie": androidAndMSIE,
+		"company":          Equals(FieldCompany, "Flashpoint"),
+		"country or opera": Or(Contains(FieldCountry, "Republic"), Contains(FieldBrowser, "Opera")),
+		"not android":      And(Not(Contains(FieldBrowser, "Android")), mustRegexp(t, FieldEmailDomain, `^Muxo`)),
+		"regexp browser":   mustRegexp(t, FieldBrowser, `MSIE [6-8]\.0`),
+	}
+	for name, q := range queries {
+		out := new(bytes.Buffer)
+		FastSearchQuery(out, q)
+		if expected := referenceSearch(t, q); out.String() != expected {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", name, out.String(), expected)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	user := &models.User{
+		Browsers: []string{"Mozilla/5.0 (Linux; Android 4.4.2)", "Opera/9.80"},
+		Company:  "Flashpoint",
+		Country:  "Dominican Republic",
+		Email:    "JonathanMorris@Muxo.edu",
+	}
+
+	cases := []struct {
+		query string
+		match bool
+	}{
+		{`{"field":"company","equals":"Flashpoint"}`, true},
+		{`{"and":[{"field":"browser","contains":"Android"},{"field":"browser","contains":"MSIE"}]}`, false},
+		{`{"or":[{"field":"browser","contains":"MSIE"},{"field":"browser_family","equals":"Opera"}]}`, true},
+		{`{"not":{"field":"email_domain","regexp":"\\.edu$"}}`, false},
+		{`{"and":[]}`, true},
+	}
+	for _, c := range cases {
+		q, err := ParseQuery([]byte(c.query))
+		if err != nil {
+			t.Fatalf("%s: %s", c.query, err)
+		}
+		if got := q.Match(user); got != c.match {
+			t.Errorf("%s: expected %v, got %v", c.query, c.match, got)
+		}
+	}
+
+	for _, bad := range []string{
+		``,
+		`{}`,
+		`{"field":"name","equals":"x"}`,
+		`{"field":"browser","equals":"x","contains":"y"}`,
+		`{"and":[{"field":"browser"}]}`,
+		`{"not":{"field":"os","regexp":"("}}`,
+		`{"or":{"field":"os","equals":"x"}}`,
+	} {
+		if _, err := ParseQuery([]byte(bad)); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
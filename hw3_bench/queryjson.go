@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var fieldNames = map[string]Field{
+	"browser":         FieldBrowser,
+	"company":         FieldCompany,
+	"country":         FieldCountry,
+	"email_domain":    FieldEmailDomain,
+	"browser_family":  FieldBrowserFamily,
+	"browser_version": FieldBrowserVersion,
+	"os":              FieldOS,
+	"device":          FieldDevice,
+}
+
+// querySpec запрос в json: либо одно из and/or/not, либо field и одно из equals/contains/regexp
+//
+//	{"and":[{"field":"browser","contains":"Android"},{"field":"browser","contains":"MSIE"}]}
+type querySpec struct {
+	And      []querySpec `json:"and"`
+	Or       []querySpec `json:"or"`
+	Not      *querySpec  `json:"not"`
+	Field    string      `json:"field"`
+	Equals   *string     `json:"equals"`
+	Contains *string     `json:"contains"`
+	Regexp   *string     `json:"regexp"`
+}
+
+// ParseQuery разбирает запрос в json, формат в querySpec
+func ParseQuery(data []byte) (Query, error) {
+	spec := querySpec{}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("bad query: %s", err)
+	}
+	return spec.query()
+}
+
+func (s *querySpec) query() (Query, error) {
+	set := 0
+	for _, ok := range []bool{s.And != nil, s.Or != nil, s.Not != nil, s.Equals != nil, s.Contains != nil, s.Regexp != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.New("bad query: exactly one of and, or, not, equals, contains, regexp expected")
+	}
+
+	switch {
+	case s.And != nil:
+		qs, err := subqueries(s.And)
+		return And(qs...), err
+	case s.Or != nil:
+		qs, err := subqueries(s.Or)
+		return Or(qs...), err
+	case s.Not != nil:
+		q, err := s.Not.query()
+		return Not(q), err
+	}
+
+	field, ok := fieldNames[s.Field]
+	if !ok {
+		return nil, fmt.Errorf("bad query: unknown field %q", s.Field)
+	}
+	switch {
+	case s.Equals != nil:
+		return Equals(field, *s.Equals), nil
+	case s.Contains != nil:
+		return Contains(field, *s.Contains), nil
+	}
+	return Regexp(field, *s.Regexp)
+}
+
+func subqueries(specs []querySpec) ([]Query, error) {
+	qs := make([]Query, len(specs))
+	for i := range specs {
+		q, err := specs[i].query()
+		if err != nil {
+			return nil, err
+		}
+		qs[i] = q
+	}
+	return qs, nil
+}
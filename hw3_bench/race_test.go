@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package main
+
+// raceEnabled с -race аллокации и время другие, baseline к ним не подходит
+const raceEnabled = true
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/moguchev/coursera_go/hw3_bench/datagen"
+)
+
+// Проверка регрессий идёт при каждом go test: результаты сравниваются с baseline
+// из testdata/bench_baseline.json, тест падает при регрессии больше порога.
+// Сравниваются B/op и allocs/op, а время - только в отношении к SlowSearch на тех же данных,
+// чтобы baseline годился для любой машины.
+//
+// go test -run Regression -regress.update          перезаписать baseline
+// go test -run Regression -regress.history=h.json  дописать результаты в историю
+var (
+	regressBaseline      = flag.String("regress.baseline", "testdata/bench_baseline.json", "benchmark baseline file")
+	regressHistory       = flag.String("regress.history", "", "append results to this benchmark history file")
+	regressThreshold     = flag.Float64("regress.threshold", 0.25, "allowed B/op and allocs/op growth against baseline, 0.25 = 25%")
+	regressTimeThreshold = flag.Float64("regress.time", 0.5, "allowed growth of time relative to SlowSearch against baseline")
+	regressUpdate        = flag.Bool("regress.update", false, "store current results as the new baseline")
+)
+
+// размеры сгенерированных файлов в строках
+var regressSizes = []int{1000, 2000, 5000}
+
+// каждая реализация после прогрева меряется не меньше regressRuns раз и не меньше regressTime
+const (
+	regressRuns = 3
+	regressTime = 100 * time.Millisecond
+)
+
+// benchMetrics результаты одной реализации на одном размере.
+// SlowRatio - во сколько раз она медленнее SlowSearch, 0 - время не сравнивается
+type benchMetrics struct {
+	NsPerOp     int64   `json:"ns_op"`
+	BytesPerOp  int64   `json:"b_op"`
+	AllocsPerOp int64   `json:"allocs_op"`
+	SlowRatio   float64 `json:"slow_ratio,omitempty"`
+}
+
+type benchRun struct {
+	Time    time.Time               `json:"time"`
+	Go      string                  `json:"go"`
+	Results map[string]benchMetrics `json:"results"`
+}
+
+type benchHistory struct {
+	Runs []benchRun `json:"runs"`
+}
+
+type regression struct {
+	name     string
+	metric   string
+	baseline float64
+	current  float64
+}
+
+func (r regression) String() string {
+	return fmt.Sprintf("%s %s: %.4g -> %.4g (%+.1f%%)", r.name, r.metric, r.baseline, r.current,
+		100*(r.current-r.baseline)/r.baseline)
+}
+
+// compareBaseline регрессии больше threshold по памяти и больше timeThreshold по SlowRatio.
+// Бенчмарков, которых нет в baseline, не проверяем
+func compareBaseline(baseline, current map[string]benchMetrics, threshold, timeThreshold float64) []regression {
+	res := []regression{}
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		base, ok := baseline[name]
+		if !ok {
+			continue
+		}
+		cur := current[name]
+		check := func(metric string, b, c, threshold float64) {
+			if c > b*(1+threshold) {
+				res = append(res, regression{name, metric, b, c})
+			}
+		}
+		check("B/op", float64(base.BytesPerOp), float64(cur.BytesPerOp), threshold)
+		check("allocs/op", float64(base.AllocsPerOp), float64(cur.AllocsPerOp), threshold)
+		if base.SlowRatio > 0 && cur.SlowRatio > 0 {
+			check("time/slow", base.SlowRatio, cur.SlowRatio, timeThreshold)
+		}
+	}
+	return res
+}
+
+// measure прогоняет search после прогрева не меньше runs раз и не меньше minTime.
+// Время - лучший прогон: он меньше всех зависит от остальной нагрузки на машину
+func measure(runs int, minTime time.Duration, search func() error) (benchMetrics, error) {
+	if err := search(); err != nil {
+		return benchMetrics{}, err
+	}
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	best := time.Duration(0)
+	n := 0
+	for ; n < runs || time.Since(start) < minTime; n++ {
+		runStart := time.Now()
+		if err := search(); err != nil {
+			return benchMetrics{}, err
+		}
+		if d := time.Since(runStart); best == 0 || d < best {
+			best = d
+		}
+	}
+	runtime.ReadMemStats(&after)
+	return benchMetrics{
+		NsPerOp:     best.Nanoseconds(),
+		BytesPerOp:  int64(after.TotalAlloc-before.TotalAlloc) / int64(n),
+		AllocsPerOp: int64(after.Mallocs-before.Mallocs) / int64(n),
+	}, nil
+}
+
+func loadJSON(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func saveJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func TestRegression(t *testing.T) {
+	if testing.Short() || raceEnabled {
+		t.Skip("benchmark regression is skipped in short mode and with -race")
+	}
+
+	// timed - сравнивать ли время: у parallel оно зависит от числа ядер машины
+	implementations := []struct {
+		name   string
+		timed  bool
+		search func(path string, out *bytes.Buffer) error
+	}{
+		{"slow", false, func(path string, out *bytes.Buffer) error {
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			SlowSearchReader(file, out)
+			return nil
+		}},
+		{"fast", true, func(path string, out *bytes.Buffer) error {
+			return (&Searcher{}).SearchFile(path, out, androidAndMSIE)
+		}},
+		{"parallel", false, func(path string, out *bytes.Buffer) error {
+			return (&Searcher{Workers: 4}).SearchFile(path, out, androidAndMSIE)
+		}},
+	}
+
+	current := map[string]benchMetrics{}
+	dir := t.TempDir()
+	for _, size := range regressSizes {
+		path := filepath.Join(dir, fmt.Sprintf("users_%d.txt", size))
+		if err := ioutil.WriteFile(path, generateUsers(t, datagen.Config{Users: size, Seed: int64(size)}), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// сначала все реализации должны выдать одно и то же
+		expected := ""
+		for i, impl := range implementations {
+			out := new(bytes.Buffer)
+			if err := impl.search(path, out); err != nil {
+				t.Fatalf("%s/%d: %s", impl.name, size, err)
+			}
+			if i == 0 {
+				expected = out.String()
+			} else if out.String() != expected {
+				t.Fatalf("%s/%d: results not match\nGot:\n%v\nExpected:\n%v", impl.name, size, out, expected)
+			}
+		}
+
+		var slowNs int64
+		for _, impl := range implementations {
+			impl := impl
+			out := new(bytes.Buffer)
+			m, err := measure(regressRuns, regressTime, func() error {
+				out.Reset()
+				return impl.search(path, out)
+			})
+			if err != nil {
+				t.Fatalf("%s/%d: %s", impl.name, size, err)
+			}
+			if impl.name == "slow" {
+				slowNs = m.NsPerOp
+			}
+			if impl.timed && slowNs > 0 {
+				m.SlowRatio = float64(m.NsPerOp) / float64(slowNs)
+			}
+			name := fmt.Sprintf("%s/%d", impl.name, size)
+			current[name] = m
+			t.Logf("%-16s %10d ns/op %10d B/op %8d allocs/op %6.3f of slow", name, m.NsPerOp, m.BytesPerOp, m.AllocsPerOp, m.SlowRatio)
+		}
+	}
+
+	if *regressHistory != "" {
+		history := &benchHistory{}
+		if err := loadJSON(*regressHistory, history); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		history.Runs = append(history.Runs, benchRun{Time: time.Now().UTC(), Go: runtime.Version(), Results: current})
+		if err := saveJSON(*regressHistory, history); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if *regressUpdate {
+		if err := saveJSON(*regressBaseline, current); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	baseline := map[string]benchMetrics{}
+	if err := loadJSON(*regressBaseline, &baseline); err != nil {
+		t.Fatalf("cant load baseline, store one with -regress.update: %s", err)
+	}
+	for _, r := range compareBaseline(baseline, current, *regressThreshold, *regressTimeThreshold) {
+		t.Errorf("regression %s", r)
+	}
+}
+
+func TestCompareBaseline(t *testing.T) {
+	baseline := map[string]benchMetrics{
+		"fast/1000": {NsPerOp: 1000, BytesPerOp: 100, AllocsPerOp: 10, SlowRatio: 0.2},
+		"slow/1000": {NsPerOp: 5000, BytesPerOp: 500, AllocsPerOp: 50},
+	}
+	current := map[string]benchMetrics{
+		// ns/op сам по себе не сравнивается, только SlowRatio
+		"fast/1000": {NsPerOp: 9000, BytesPerOp: 100, AllocsPerOp: 13, SlowRatio: 0.35},
+		"slow/1000": {NsPerOp: 45000, BytesPerOp: 900, AllocsPerOp: 50},
+		"new/1000":  {NsPerOp: 1, BytesPerOp: 1, AllocsPerOp: 1},
+	}
+	got := []string{}
+	for _, r := range compareBaseline(baseline, current, 0.2, 0.5) {
+		got = append(got, r.name+" "+r.metric)
+	}
+	expected := []string{"fast/1000 allocs/op", "fast/1000 time/slow", "slow/1000 B/op"}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := loadJSON(path, &map[string]benchMetrics{}); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist error for missing file, got %v", err)
+	}
+	if err := saveJSON(path, baseline); err != nil {
+		t.Fatal(err)
+	}
+	loaded := map[string]benchMetrics{}
+	if err := loadJSON(path, &loaded); err != nil || loaded["fast/1000"] != baseline["fast/1000"] {
+		t.Errorf("baseline not saved: %v %v", loaded, err)
+	}
+}
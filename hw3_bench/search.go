@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Searcher быстрый поиск с настройками. Нулевое значение - последовательный поиск
+type Searcher struct {
+	// Workers сколько горутин разбирают файл, <= 1 - последовательно в одной
+	Workers int
+	// Unique что считать разными браузерами в "Total unique browsers"
+	Unique UniqueBy
+	// Output формат вывода, по умолчанию как у SlowSearch
+	Output Output
+	// Precision если не 0, уникальные браузеры считаются HyperLogLog'ом на 2^Precision регистров:
+	// память не растёт с числом браузеров, но итог приблизительный
+	Precision uint8
+	// TopK сколько самых частых браузеров вывести после итога, 0 - не выводить
+	TopK int
+}
+
+// UniqueBy ключ, по которому считаются уникальные браузеры
+type UniqueBy int
+
+const (
+	// UniqueRaw строка браузера целиком, как в SlowSearch
+	UniqueRaw UniqueBy = iota
+	// UniqueFamily семейство из ParseUserAgent: все Chrome считаются одним браузером
+	UniqueFamily
+	// UniqueFamilyVersion семейство и версия major.minor: "Chrome 12.0"
+	UniqueFamilyVersion
+)
+
+func (u UniqueBy) key(browser []byte) []byte {
+	switch u {
+	case UniqueFamily:
+		return lookupUserAgent(browser).family
+	case UniqueFamilyVersion:
+		return lookupUserAgent(browser).familyVersion
+	default:
+		return browser
+	}
+}
+
+// Search ищет пользователей в r с настройками по умолчанию
+func Search(r io.Reader, out io.Writer, q Query) error {
+	return (&Searcher{}).Search(r, out, q)
+}
+
+// SearchFile ищет пользователей в файле path и пишет результат в формате s.Output.
+// Обычный файл отображается в память и разбирается без копирования
+func (s *Searcher) SearchFile(path string, out io.Writer, q Query) error {
+	return s.SearchFileContext(context.Background(), path, out, q)
+}
+
+// SearchFileContext то же, что SearchFile, но останавливается с ctx.Err(), когда ctx отменён
+func (s *Searcher) SearchFileContext(ctx context.Context, path string, out io.Writer, q Query) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, unmap, err := mmapFile(file)
+	if err != nil {
+		// pipe, устройство или платформа без mmap
+		return s.SearchContext(ctx, file, out, q)
+	}
+	defer unmap()
+
+	if DetectCompression(data) != CompressionNone {
+		return s.SearchContext(ctx, bytes.NewReader(data), out, q)
+	}
+
+	return s.searchBytes(ctx, data, out, q)
+}
+
+// Search читает пользователей из r построчно, длина строки не ограничена.
+// Сжатый gzip или zstd вход распаковывается на лету
+func (s *Searcher) Search(r io.Reader, out io.Writer, q Query) error {
+	return s.SearchContext(context.Background(), r, out, q)
+}
+
+// ctxCheckLines как часто между строками проверяется отмена контекста
+const ctxCheckLines = 1024
+
+// SearchContext то же, что Search, но останавливается с ctx.Err(), когда ctx отменён
+func (s *Searcher) SearchContext(ctx context.Context, r io.Reader, out io.Writer, q Query) error {
+	r, closeDecoder, err := decompress(r, s.Workers)
+	if err != nil {
+		return err
+	}
+	defer closeDecoder()
+
+	if s.Workers > 1 {
+		return s.searchStream(ctx, r, out, q)
+	}
+
+	stats, err := s.newStats(1)
+	if err != nil {
+		return err
+	}
+	m := newLineMatcher(q, s.Unique)
+
+	w := newOutWriter(out, s.Output)
+	if err := w.header(); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(r, 64<<10)
+	long := []byte{}
+	for i := 0; ; i++ {
+		if i%ctxCheckLines == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		line, err := readLine(reader, &long)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		match, err := m.match(line, stats[0])
+		if err != nil {
+			return fmt.Errorf("line %d: %w", i, err)
+		}
+		if !match {
+			continue
+		}
+		if err := w.user(i, &m.view); err != nil {
+			return err
+		}
+	}
+
+	return w.footer(mergeStats(stats))
+}
+
+// readLine строка без перевода строки, как у bufio.ScanLines. Обычно это срез буфера reader'а,
+// строки длиннее буфера собираются в long
+func readLine(r *bufio.Reader, long *[]byte) ([]byte, error) {
+	line, err := readRawLine(r, long)
+	if err != nil {
+		return nil, err
+	}
+	return trimLine(line), nil
+}
+
+// readRawLine то же, что readLine, но с переводом строки на конце
+func readRawLine(r *bufio.Reader, long *[]byte) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		*long = append((*long)[:0], line...)
+		for err == bufio.ErrBufferFull {
+			line, err = r.ReadSlice('\n')
+			*long = append(*long, line...)
+		}
+		line = *long
+	}
+	// последняя строка без перевода строки
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return line, nil
+}
+
+// trimLine строка без "\n" или "\r\n" на конце
+func trimLine(line []byte) []byte {
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+	return dropCR(line)
+}
+
+func dropCR(line []byte) []byte {
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		return line[:n-1]
+	}
+	return line
+}
+
+// browserSet куда складываются браузеры, подошедшие под условия запроса
+type browserSet interface {
+	add(browser []byte)
+	len() int
+}
+
+type mapSet map[string]struct{}
+
+func (s mapSet) add(browser []byte) {
+	// string(browser) в поиске по map не аллоцирует, только при добавлении
+	if _, seen := s[string(browser)]; !seen {
+		s[string(browser)] = struct{}{}
+	}
+}
+
+func (s mapSet) len() int {
+	return len(s)
+}
+
+// browserStats подсчёт браузеров одного воркера
+type browserStats struct {
+	set browserSet
+	top *topK
+}
+
+func (b *browserStats) add(browser []byte) {
+	b.set.add(browser)
+	if b.top != nil {
+		b.top.add(browser)
+	}
+}
+
+func (b *browserStats) len() int {
+	return b.set.len()
+}
+
+// newStats счётчики для n воркеров. Точное множество у всех общее, HyperLogLog и top-K
+// у каждого свои, без блокировок, и сливаются в mergeStats
+func (s *Searcher) newStats(n int) ([]*browserStats, error) {
+	var shared browserSet = mapSet{}
+	if n > 1 {
+		shared = newShardedSet()
+	}
+	stats := make([]*browserStats, n)
+	for i := range stats {
+		stats[i] = &browserStats{set: shared}
+		if s.Precision > 0 {
+			hll, err := NewHyperLogLog(s.Precision)
+			if err != nil {
+				return nil, err
+			}
+			stats[i].set = hll
+		}
+		if s.TopK > 0 {
+			stats[i].top = newTopK(s.TopK)
+		}
+	}
+	return stats, nil
+}
+
+// mergeStats число уникальных браузеров и самые частые из них по всем воркерам
+func mergeStats(stats []*browserStats) (int, []BrowserCount) {
+	first := stats[0]
+	for _, other := range stats[1:] {
+		if hll, ok := first.set.(*HyperLogLog); ok {
+			hll.Merge(other.set.(*HyperLogLog))
+		}
+		if first.top != nil {
+			first.top.merge(other.top)
+		}
+	}
+	if first.top == nil {
+		return first.len(), nil
+	}
+	return first.len(), first.top.top()
+}
+
+// lineMatcher обработка одной строки, общая для последовательного и параллельного поиска
+type lineMatcher struct {
+	q      Query
+	terms  []*term
+	unique UniqueBy
+	pf     *prefilter
+	view   userView
+}
+
+func newLineMatcher(q Query, unique UniqueBy) *lineMatcher {
+	terms := q.browserTerms()
+	return &lineMatcher{q: q, terms: terms, unique: unique, pf: newPrefilter(q, terms)}
+}
+
+// match складывает подходящие браузеры в seen и говорит, подходит ли пользователь под запрос.
+// Строки, которые точно не подходят ни под запрос, ни под подсчёт браузеров, не разбираются.
+// После true разобранный пользователь лежит в m.view
+func (m *lineMatcher) match(line []byte, seen browserSet) (bool, error) {
+	m.pf.reset(line)
+	match := m.pf.mayMatch(&m.pf.query)
+	if !match && !m.pf.mayMatch(&m.pf.browsers) {
+		return false, nil
+	}
+
+	if err := m.view.scan(line); err != nil {
+		return false, err
+	}
+
+	for _, browser := range m.view.Browsers {
+		for _, t := range m.terms {
+			if t.matchBrowser(browser) {
+				seen.add(m.unique.key(browser))
+				break
+			}
+		}
+	}
+
+	return match && m.q.matchView(&m.view), nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/moguchev/coursera_go/hw3_bench/datagen"
+)
+
+func generateUsers(t testing.TB, cfg datagen.Config) []byte {
+	buf := new(bytes.Buffer)
+	if err := datagen.Generate(buf, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSearchReader(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slowOut := new(bytes.Buffer)
+	SlowSearchReader(bytes.NewReader(data), slowOut)
+	expected := slowOut.String()
+
+	for _, workers := range []int{0, 4} {
+		out := new(bytes.Buffer)
+		// по байту, чтобы строки приходили кусками
+		if err := (&Searcher{Workers: workers}).Search(iotest.OneByteReader(bytes.NewReader(data)), out, androidAndMSIE); err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); got != expected {
+			t.Errorf("[workers %d] results not match\nGot:\n%v\nExpected:\n%v", workers, got, expected)
+		}
+	}
+}
+
+func TestSearchLongLines(t *testing.T) {
+	// строки длиннее 64KiB, на которых ломался bufio.Scanner
+	long := strings.Repeat("x", 200<<10)
+	input := `{"browsers":["Opera"],"email":"a@b","name":"short"}` + "\r\n" +
+		`{"browsers":["Android ` + long + `","MSIE"],"email":"c@d","name":"long"}` + "\n" +
+		`{"browsers":["MSIE ` + long + `"],"email":"e@f","name":"no"}` + "\n" +
+		`{"browsers":["MSIE","Android"],"email":"g@h","name":"last"}`
+	expected := "found users:\n[1] long <c [at] d>\n[3] last <g [at] h>\n\nTotal unique browsers 4\n"
+
+	path := filepath.Join(t.TempDir(), "users.txt")
+	if err := ioutil.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{0, 3} {
+		s := &Searcher{Workers: workers}
+		out := new(bytes.Buffer)
+		if err := s.Search(strings.NewReader(input), out, androidAndMSIE); err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); got != expected {
+			t.Errorf("[workers %d] Search: got\n%q\nexpected\n%q", workers, got, expected)
+		}
+
+		out.Reset()
+		if err := s.SearchFile(path, out, androidAndMSIE); err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); got != expected {
+			t.Errorf("[workers %d] SearchFile: got\n%q\nexpected\n%q", workers, got, expected)
+		}
+	}
+}
+
+func TestSearchFileNotRegular(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		w.WriteString(`{"browsers":["MSIE Android"],"email":"a@b","name":"pipe"}` + "\n")
+		w.Close()
+	}()
+	defer r.Close()
+
+	// pipe не отображается в память, его читаем как поток
+	if _, _, err := mmapFile(r); err == nil {
+		t.Error("expected mmap error for pipe")
+	}
+	out := new(bytes.Buffer)
+	if err := Search(r, out, androidAndMSIE); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, "[0] pipe <a [at] b>") {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+func TestSearchFileEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.txt")
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := (&Searcher{}).SearchFile(path, out, androidAndMSIE); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "found users:\n\nTotal unique browsers 0\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+func TestSearchGenerated(t *testing.T) {
+	for seed := int64(1); seed <= 5; seed++ {
+		data := generateUsers(t, datagen.Config{Users: 2000, Seed: seed})
+		slowOut := new(bytes.Buffer)
+		SlowSearchReader(bytes.NewReader(data), slowOut)
+
+		for _, workers := range []int{0, 4} {
+			out := new(bytes.Buffer)
+			if err := (&Searcher{Workers: workers}).Search(bytes.NewReader(data), out, androidAndMSIE); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != slowOut.String() {
+				t.Errorf("[seed %d, workers %d] results not match\nGot:\n%v\nExpected:\n%v", seed, workers, out, slowOut)
+			}
+		}
+	}
+}
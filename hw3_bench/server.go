@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxQuerySize больше этого тело запроса не читается
+const maxQuerySize = 1 << 20
+
+// Server http-поиск по файлу пользователей:
+//
+//	POST /search             запрос в теле, формат в querySpec
+//	GET  /search?q=<запрос>
+//
+// Параметры: fields=index,name,email (см. ParseFields), email=obfuscated|plain|hashed.
+// Ответ - NDJSON: по пользователю в строке, последней строкой {"total_unique_browsers":N}.
+// Если поиск сломался посреди ответа, последней строкой будет {"error":"..."}
+type Server struct {
+	path     string
+	searcher Searcher
+	scans    chan struct{}
+}
+
+// NewServer сервер по файлу path. Одновременно идёт не больше maxScans поисков,
+// остальные сразу получают 503
+func NewServer(path string, s Searcher, maxScans int) *Server {
+	if maxScans < 1 {
+		maxScans = 1
+	}
+	return &Server{path: path, searcher: s, scans: make(chan struct{}, maxScans)}
+}
+
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/search" {
+		writeJSONError(w, http.StatusNotFound, "unknown method")
+		return
+	}
+
+	var body []byte
+	switch r.Method {
+	case http.MethodGet:
+		body = []byte(r.URL.Query().Get("q"))
+	case http.MethodPost:
+		data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxQuerySize))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		body = data
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "bad method")
+		return
+	}
+
+	q, err := ParseQuery(body)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s := srv.searcher
+	s.Output = Output{Format: FormatJSON}
+	params := r.URL.Query()
+	if fields := params.Get("fields"); fields != "" {
+		if s.Output.Fields, err = ParseFields(fields); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if email := params.Get("email"); email != "" {
+		if s.Output.Email, err = ParseEmailPolicy(email); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	select {
+	case srv.scans <- struct{}{}:
+		defer func() { <-srv.scans }()
+	default:
+		writeJSONError(w, http.StatusServiceUnavailable, "too many concurrent searches")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	stream := &flushWriter{w: w}
+	err = s.SearchFileContext(r.Context(), srv.path, stream, q)
+	switch {
+	case err == nil:
+	case r.Context().Err() != nil:
+		// клиент ушёл, писать некому
+	case stream.written:
+		w.Write(append(appendJSONString([]byte(`{"error":`), []byte(err.Error())), "}\n"...))
+	default:
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// flushWriter отдаёт клиенту каждый записанный блок сразу, а не когда заполнится буфер ответа
+type flushWriter struct {
+	w       http.ResponseWriter
+	written bool
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	fw.written = true
+	n, err := fw.w.Write(p)
+	if f, ok := fw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(appendJSONString([]byte(`{"error":`), []byte(msg)), "}\n"...))
+}
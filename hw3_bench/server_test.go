@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/moguchev/coursera_go/hw3_bench/datagen"
+)
+
+const androidAndMSIEJSON = `{"and":[{"field":"browser","contains":"Android"},{"field":"browser","contains":"MSIE"}]}`
+
+func TestServer(t *testing.T) {
+	srv := NewServer(filePath, Searcher{Workers: 2}, 2)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	expected := new(bytes.Buffer)
+	s := &Searcher{Output: Output{Format: FormatJSON, Fields: []OutputField{OutIndex, OutName}, Email: EmailHashed}}
+	if err := s.SearchFile(filePath, expected, androidAndMSIE); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(ts.URL+"/search?fields=index,name&email=hashed", "application/json", strings.NewReader(androidAndMSIEJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if string(body) != expected.String() {
+		t.Errorf("POST results not match\nGot:\n%s\nExpected:\n%s", body, expected)
+	}
+
+	resp, err = http.Get(ts.URL + "/search?fields=index,name&email=hashed&q=" + url.QueryEscape(androidAndMSIEJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != expected.String() {
+		t.Errorf("GET results not match\nGot:\n%s\nExpected:\n%s", body, expected)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	srv := NewServer(filePath, Searcher{}, 1)
+	cases := []struct {
+		method, target, body string
+		status               int
+	}{
+		{"GET", "/search?q={}", "", http.StatusBadRequest},
+		{"POST", "/search", `{"field":"phone","equals":"1"}`, http.StatusBadRequest},
+		{"POST", "/search?fields=phone", androidAndMSIEJSON, http.StatusBadRequest},
+		{"POST", "/search?email=rot13", androidAndMSIEJSON, http.StatusBadRequest},
+		{"PUT", "/search", androidAndMSIEJSON, http.StatusMethodNotAllowed},
+		{"GET", "/users", "", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(c.method, c.target, strings.NewReader(c.body)))
+		if w.Code != c.status || !strings.HasPrefix(w.Body.String(), `{"error":`) {
+			t.Errorf("%s %s: got %d %s", c.method, c.target, w.Code, w.Body)
+		}
+	}
+
+	missing := NewServer(filePath+".missing", Searcher{}, 1)
+	w := httptest.NewRecorder()
+	missing.ServeHTTP(w, httptest.NewRequest("POST", "/search", strings.NewReader(androidAndMSIEJSON)))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("missing file: got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestServerConcurrencyLimit(t *testing.T) {
+	srv := NewServer(filePath, Searcher{}, 1)
+	// единственный слот занят другим поиском
+	srv.scans <- struct{}{}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest("POST", "/search", strings.NewReader(androidAndMSIEJSON)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+
+	<-srv.scans
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest("POST", "/search", strings.NewReader(androidAndMSIEJSON)))
+	if w.Code != http.StatusOK {
+		t.Errorf("slot released: got %d %s", w.Code, w.Body)
+	}
+}
+
+// cancelWriter отменяет контекст на первой записи: поиск уже идёт, дальше он должен остановиться
+type cancelWriter struct {
+	cancel func()
+	n      int
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.n++
+	w.cancel()
+	return len(p), nil
+}
+
+func TestSearchContextCancel(t *testing.T) {
+	data := generateUsers(t, datagen.Config{Users: 20000, Seed: 2})
+	defer func(n int) { minChunkSize = n }(minChunkSize)
+	minChunkSize = 1 << 10
+
+	for _, workers := range []int{0, 4} {
+		s := &Searcher{Workers: workers}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := s.SearchContext(ctx, bytes.NewReader(data), ioutil.Discard, androidAndMSIE); err != context.Canceled {
+			t.Errorf("[workers %d] canceled before start: got %v", workers, err)
+		}
+
+		full := &cancelWriter{cancel: func() {}}
+		if err := s.Search(bytes.NewReader(data), full, Contains(FieldBrowser, "")); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+		// bufio в outWriter пишет блоками по 4KiB, первый блок - задолго до конца
+		w := &cancelWriter{cancel: cancel}
+		err := s.SearchContext(ctx, bytes.NewReader(data), w, Contains(FieldBrowser, ""))
+		if err != context.Canceled {
+			t.Errorf("[workers %d] canceled midway: got %v", workers, err)
+		}
+		// отмена проверяется раз в ctxCheckLines строк, так что пара блоков ещё успевает уйти
+		if w.n > full.n/4 {
+			t.Errorf("[workers %d] %d writes of %d after cancel", workers, w.n, full.n)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// Границы точности HyperLogLog: 2^precision регистров по байту, ошибка примерно 1.04/sqrt(2^precision)
+const (
+	MinPrecision = 4
+	MaxPrecision = 18
+)
+
+var errPrecisionMismatch = errors.New("hyperloglog: precision mismatch")
+
+// hash64 fnv-1a с перемешиванием из murmur3: у голого fnv плохие старшие биты
+func hash64(b []byte) uint64 {
+	h := uint64(14695981039346656037)
+	for _, c := range b {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// HyperLogLog приблизительное число различных строк в фиксированной памяти.
+// Не потокобезопасен: у каждого воркера свой, в конце они сливаются через Merge
+type HyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+// NewHyperLogLog пустой счётчик на 2^precision регистров
+func NewHyperLogLog(precision uint8) (*HyperLogLog, error) {
+	if precision < MinPrecision || precision > MaxPrecision {
+		return nil, fmt.Errorf("hyperloglog: precision %d out of range [%d, %d]", precision, MinPrecision, MaxPrecision)
+	}
+	return &HyperLogLog{precision: precision, registers: make([]uint8, 1<<precision)}, nil
+}
+
+// Add учитывает строку b
+func (h *HyperLogLog) Add(b []byte) {
+	x := hash64(b)
+	idx := x >> (64 - h.precision)
+	// ранг первой единицы в оставшихся битах; сторожевой бит не даёт выйти за 64-precision+1
+	rank := uint8(bits.LeadingZeros64(x<<h.precision|1<<(h.precision-1))) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// Merge добавляет в h всё, что видел other. Точность должна совпадать
+func (h *HyperLogLog) Merge(other *HyperLogLog) error {
+	if h.precision != other.precision {
+		return errPrecisionMismatch
+	}
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+	return nil
+}
+
+// Count оценка числа различных строк
+func (h *HyperLogLog) Count() uint64 {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	var alpha float64
+	switch len(h.registers) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+	estimate := alpha * m * m / sum
+	// на малых числах точнее linear counting по пустым регистрам
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+func (h *HyperLogLog) add(browser []byte) {
+	h.Add(browser)
+}
+
+func (h *HyperLogLog) len() int {
+	return int(h.Count())
+}
+
+// countMin count-min sketch: частота строки сверху с ошибкой порядка total/width
+type countMin struct {
+	width    uint64
+	counters [][]uint32
+}
+
+const (
+	countMinWidth = 2048
+	countMinDepth = 4
+)
+
+func newCountMin() *countMin {
+	c := &countMin{width: countMinWidth, counters: make([][]uint32, countMinDepth)}
+	for i := range c.counters {
+		c.counters[i] = make([]uint32, countMinWidth)
+	}
+	return c
+}
+
+// add учитывает b и возвращает новую оценку его частоты
+func (c *countMin) add(b []byte) uint64 {
+	h := hash64(b)
+	h1, h2 := h&0xffffffff, h>>32
+	min := uint32(math.MaxUint32)
+	for i, row := range c.counters {
+		cell := &row[(h1+uint64(i)*h2)%c.width]
+		*cell++
+		if *cell < min {
+			min = *cell
+		}
+	}
+	return uint64(min)
+}
+
+func (c *countMin) estimate(b []byte) uint64 {
+	h := hash64(b)
+	h1, h2 := h&0xffffffff, h>>32
+	min := uint32(math.MaxUint32)
+	for i, row := range c.counters {
+		if cell := row[(h1+uint64(i)*h2)%c.width]; cell < min {
+			min = cell
+		}
+	}
+	return uint64(min)
+}
+
+func (c *countMin) merge(other *countMin) {
+	for i, row := range other.counters {
+		for j, n := range row {
+			c.counters[i][j] += n
+		}
+	}
+}
+
+// BrowserCount браузер и сколько раз он встретился (оценка count-min sketch)
+type BrowserCount struct {
+	Browser string
+	Count   uint64
+}
+
+// topK самые частые браузеры: count-min считает всех, а в candidates держатся k лидеров
+type topK struct {
+	k          int
+	sketch     *countMin
+	candidates map[string]uint64
+	minKey     string
+	minCount   uint64
+}
+
+func newTopK(k int) *topK {
+	return &topK{k: k, sketch: newCountMin(), candidates: make(map[string]uint64, k)}
+}
+
+func (t *topK) add(browser []byte) {
+	count := t.sketch.add(browser)
+	if _, ok := t.candidates[string(browser)]; ok {
+		t.candidates[string(browser)] = count
+		if string(browser) == t.minKey {
+			t.updateMin()
+		}
+		return
+	}
+	if len(t.candidates) < t.k {
+		t.candidates[string(browser)] = count
+		t.updateMin()
+		return
+	}
+	if count > t.minCount {
+		delete(t.candidates, t.minKey)
+		t.candidates[string(browser)] = count
+		t.updateMin()
+	}
+}
+
+func (t *topK) updateMin() {
+	first := true
+	for key, count := range t.candidates {
+		if first || count < t.minCount || count == t.minCount && key > t.minKey {
+			t.minKey, t.minCount, first = key, count, false
+		}
+	}
+}
+
+// merge складывает счётчики и заново выбирает лидеров из кандидатов обоих
+func (t *topK) merge(other *topK) {
+	t.sketch.merge(other.sketch)
+	for key := range other.candidates {
+		t.candidates[key] = 0
+	}
+	top := t.top()
+	t.candidates = make(map[string]uint64, t.k)
+	for _, bc := range top {
+		t.candidates[bc.Browser] = bc.Count
+	}
+	t.updateMin()
+}
+
+// top не больше k лидеров, от частых к редким. Частоты берутся из sketch заново:
+// сохранённые в candidates могли отстать из-за коллизий с другими браузерами
+func (t *topK) top() []BrowserCount {
+	top := make([]BrowserCount, 0, len(t.candidates))
+	for key := range t.candidates {
+		top = append(top, BrowserCount{Browser: key, Count: t.sketch.estimate([]byte(key))})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Browser < top[j].Browser
+	})
+	if len(top) > t.k {
+		top = top[:t.k]
+	}
+	return top
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/moguchev/coursera_go/hw3_bench/datagen"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, precision := range []uint8{MinPrecision, 10, 14} {
+		h, err := NewHyperLogLog(precision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// с запасом в три стандартных ошибки
+		maxErr := 3 * 1.04 / math.Sqrt(float64(uint64(1)<<precision))
+		for _, n := range []int{0, 10, 1000, 100000} {
+			h, _ = NewHyperLogLog(precision)
+			for i := 0; i < n; i++ {
+				h.Add([]byte("browser " + strconv.Itoa(i)))
+				// повторы не считаются
+				h.Add([]byte("browser " + strconv.Itoa(i/2)))
+			}
+			got := float64(h.Count())
+			if n == 0 && got != 0 || n > 0 && math.Abs(got-float64(n))/float64(n) > maxErr {
+				t.Errorf("[precision %d] n %d: got %v", precision, n, got)
+			}
+		}
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	all, _ := NewHyperLogLog(12)
+	parts := make([]*HyperLogLog, 3)
+	for i := range parts {
+		parts[i], _ = NewHyperLogLog(12)
+	}
+	for i := 0; i < 50000; i++ {
+		b := []byte("browser " + strconv.Itoa(i))
+		all.Add(b)
+		parts[i%3].Add(b)
+		parts[(i+1)%3].Add(b)
+	}
+	for _, p := range parts[1:] {
+		if err := parts[0].Merge(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, expected := parts[0].Count(), all.Count(); got != expected {
+		t.Errorf("merged %d, expected %d", got, expected)
+	}
+
+	other, _ := NewHyperLogLog(10)
+	if err := all.Merge(other); err == nil {
+		t.Error("expected precision mismatch")
+	}
+	if _, err := NewHyperLogLog(MaxPrecision + 1); err == nil {
+		t.Error("expected precision out of range")
+	}
+}
+
+func TestTopK(t *testing.T) {
+	// browser i встречается 1000/(i+1) раз, плюс длинный хвост единичных
+	stream := [][]byte{}
+	for i := 0; i < 50; i++ {
+		for j := 0; j < 1000/(i+1); j++ {
+			stream = append(stream, []byte("browser "+strconv.Itoa(i)))
+		}
+	}
+	for i := 0; i < 5000; i++ {
+		stream = append(stream, []byte("rare "+strconv.Itoa(i)))
+	}
+	// перемешиваем детерминированно, чтобы лидеры приходили не первыми
+	for i := range stream {
+		j := (i * 7919) % len(stream)
+		stream[i], stream[j] = stream[j], stream[i]
+	}
+
+	whole := newTopK(5)
+	parts := []*topK{newTopK(5), newTopK(5), newTopK(5)}
+	for i, b := range stream {
+		whole.add(b)
+		parts[i%len(parts)].add(b)
+	}
+	for _, p := range parts[1:] {
+		parts[0].merge(p)
+	}
+
+	for name, top := range map[string][]BrowserCount{"whole": whole.top(), "merged": parts[0].top()} {
+		if len(top) != 5 {
+			t.Fatalf("[%s] got %d browsers", name, len(top))
+		}
+		for i, bc := range top {
+			exact := uint64(1000 / (i + 1))
+			if bc.Browser != "browser "+strconv.Itoa(i) || bc.Count < exact || bc.Count > exact+exact/10 {
+				t.Errorf("[%s] %d: got %+v, expected browser %d with ~%d", name, i, bc, i, exact)
+			}
+		}
+	}
+}
+
+func TestSearchApproximate(t *testing.T) {
+	data := generateUsers(t, datagen.Config{Users: 5000, Seed: 9, Adversarial: 0.1})
+	exact := new(bytes.Buffer)
+	if err := (&Searcher{}).Search(bytes.NewReader(data), exact, Contains(FieldBrowser, "")); err != nil {
+		t.Fatal(err)
+	}
+	expected := totalBrowsers(t, exact.String())
+
+	outs := []string{}
+	for _, workers := range []int{0, 4} {
+		s := &Searcher{Workers: workers, Precision: 14, TopK: 3, Output: Output{Format: FormatJSON}}
+		out := new(bytes.Buffer)
+		if err := s.Search(bytes.NewReader(data), out, Contains(FieldBrowser, "")); err != nil {
+			t.Fatal(err)
+		}
+		outs = append(outs, out.String())
+	}
+	type summary struct {
+		Total int `json:"total_unique_browsers"`
+		Top   []struct {
+			Browser string `json:"browser"`
+			Count   uint64 `json:"count"`
+		} `json:"top_browsers"`
+	}
+	summaries := make([]summary, len(outs))
+	for i, out := range outs {
+		lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+		if err := json.Unmarshal([]byte(lines[len(lines)-1]), &summaries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// регистры сливаются через max, так что от числа воркеров оценка не зависит
+	if summaries[0].Total != summaries[1].Total {
+		t.Errorf("sequential %d, parallel %d", summaries[0].Total, summaries[1].Total)
+	}
+	if math.Abs(float64(summaries[0].Total-expected))/float64(expected) > 0.03 {
+		t.Errorf("approximate %d, exact %d", summaries[0].Total, expected)
+	}
+	// у воркеров свои кандидаты, на равных частотах хвост списка может отличаться, лидер - нет
+	for _, s := range summaries {
+		if len(s.Top) != 3 || s.Top[0] != summaries[0].Top[0] || s.Top[0].Count < s.Top[2].Count {
+			t.Errorf("bad top browsers: %+v", s.Top)
+		}
+	}
+
+	if err := (&Searcher{Precision: 1}).Search(bytes.NewReader(data), new(bytes.Buffer), androidAndMSIE); err == nil {
+		t.Error("expected precision error")
+	}
+}
+
+func totalBrowsers(t *testing.T, out string) int {
+	idx := strings.LastIndex(out, "Total unique browsers ")
+	if idx < 0 {
+		t.Fatalf("no total in %q", out)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(out[idx+len("Total unique browsers "):]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func BenchmarkBrowserCount(b *testing.B) {
+	data := generateUsers(b, datagen.Config{Users: 20000, Seed: 1})
+	all := Contains(FieldBrowser, "")
+	for _, c := range []struct {
+		name string
+		s    Searcher
+	}{
+		{"exact", Searcher{}},
+		{"hll14", Searcher{Precision: 14}},
+		{"hll14+top10", Searcher{Precision: 14, TopK: 10}},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c.s.Search(bytes.NewReader(data), ioutil.Discard, all)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// значения UserAgent.Device
+const (
+	DeviceDesktop = "Desktop"
+	DeviceMobile  = "Mobile"
+	DeviceTablet  = "Tablet"
+	DeviceBot     = "Bot"
+	// Other то, что не удалось распознать, в любом поле
+	Other = "Other"
+)
+
+// UserAgent строка браузера, разобранная на части
+type UserAgent struct {
+	// Family семейство браузера: Chrome, IE, Firefox, Mobile Safari...
+	Family string
+	// Version major.minor, пустая если версии нет
+	Version   string
+	OS        string
+	OSVersion string
+	// Device класс устройства, одна из констант Device*
+	Device string
+}
+
+// uaRule семейство определяется по первому подошедшему правилу
+type uaRule struct {
+	token  string // что ищем в строке
+	family string
+	// versions после чего брать версию, по порядку. По умолчанию сразу после token
+	versions []string
+}
+
+var uaFamilies = []uaRule{
+	{token: "Opera Mini/", family: "Opera Mini"},
+	{token: "OPR/", family: "Opera"},
+	{token: "Opera", family: "Opera", versions: []string{"Version/", "Opera/", "Opera "}},
+	{token: "Edge/", family: "Edge"},
+	{token: "IEMobile", family: "IE Mobile", versions: []string{"IEMobile "}},
+	{token: "MSIE ", family: "IE"},
+	{token: "Trident/", family: "IE", versions: []string{"rv:"}},
+	{token: "YaBrowser/", family: "Yandex Browser"},
+	{token: "SeaMonkey/", family: "SeaMonkey"},
+	{token: "Iceape/", family: "Iceape"},
+	{token: "Maxthon/", family: "Maxthon"},
+	{token: "QupZilla/", family: "QupZilla"},
+	{token: "Arora/", family: "Arora"},
+	{token: "Puffin/", family: "Puffin"},
+	{token: "Konqueror/", family: "Konqueror"},
+	{token: "Galeon/", family: "Galeon"},
+	{token: "NokiaBrowser/", family: "Nokia Browser"},
+	{token: "BrowserNG/", family: "Nokia Browser"},
+	{token: "UCBrowser/", family: "UC Browser"},
+	{token: "UCWEB/", family: "UC Browser"},
+	{token: "Avant Browser/", family: "Avant Browser"},
+	{token: "Netscape/", family: "Netscape"},
+	{token: "Midori/", family: "Midori"},
+	{token: "Chromium/", family: "Chromium"},
+	{token: "CriOS/", family: "Chrome Mobile iOS"},
+	{token: "Chrome/", family: "Chrome"},
+	{token: "Fennec/", family: "Firefox Mobile"},
+	{token: "Firefox/", family: "Firefox"},
+	// сборки Firefox под другими именами
+	{token: "Iceweasel/", family: "Firefox"},
+	{token: "Minefield/", family: "Firefox"},
+	{token: "Shiretoko/", family: "Firefox"},
+	{token: "NetFront/", family: "NetFront"},
+	{token: "Lynx/", family: "Lynx"},
+	{token: "ELinks", family: "ELinks", versions: []string{"ELinks/", "ELinks ("}},
+	{token: "Links (", family: "Links"},
+	{token: "Wget/", family: "Wget"},
+	{token: "curl/", family: "curl"},
+	{token: "Dillo", family: "Dillo", versions: []string{"Dillo "}},
+}
+
+var uaOS = []uaRule{
+	{token: "Windows Phone", family: "Windows Phone", versions: []string{"Windows Phone OS "}},
+	{token: "Windows CE", family: "Windows CE"},
+	{token: "Windows", family: "Windows", versions: []string{"Windows NT "}},
+	{token: "Win98", family: "Windows", versions: []string{"Win"}},
+	{token: "Win95", family: "Windows", versions: []string{"Win"}},
+	{token: "Android", family: "Android", versions: []string{"Android "}},
+	{token: "iPhone", family: "iOS", versions: []string{"OS "}},
+	{token: "iPad", family: "iOS", versions: []string{"OS "}},
+	{token: "iPod", family: "iOS", versions: []string{"OS "}},
+	{token: "Mac OS X", family: "Mac OS X", versions: []string{"Mac OS X "}},
+	{token: "CrOS", family: "Chrome OS"},
+	{token: "BB10", family: "BlackBerry OS", versions: []string{"Version/"}},
+	{token: "BlackBerry", family: "BlackBerry OS", versions: []string{"Version/"}},
+	{token: "RIM Tablet OS", family: "BlackBerry OS", versions: []string{"RIM Tablet OS "}},
+	{token: "Symbian", family: "Symbian OS", versions: []string{"SymbianOS/", "SymbianOS "}},
+	{token: "SymbOS", family: "Symbian OS"},
+	{token: "Ubuntu", family: "Ubuntu", versions: []string{"Ubuntu/"}},
+	{token: "FreeBSD", family: "FreeBSD", versions: []string{"FreeBSD "}},
+	{token: "NetBSD", family: "NetBSD"},
+	{token: "OpenBSD", family: "OpenBSD"},
+	{token: "SunOS", family: "Solaris"},
+	{token: "Linux", family: "Linux"},
+	{token: "OS/2", family: "OS/2"},
+	{token: "PalmOS", family: "Palm OS", versions: []string{"PalmOS "}},
+	{token: "webOS", family: "webOS", versions: []string{"webOS/"}},
+	{token: "BeOS", family: "BeOS"},
+}
+
+// Windows NT x.y -> название версии
+var windowsVersions = map[string]string{
+	"5.0":  "2000",
+	"5.1":  "XP",
+	"5.2":  "XP",
+	"6.0":  "Vista",
+	"6.1":  "7",
+	"6.2":  "8",
+	"6.3":  "8.1",
+	"10.0": "10",
+	// Win98, Win95
+	"98": "98",
+	"95": "95",
+}
+
+var botMarkers = []string{"bot", "crawler", "spider", "externalhit", "validator"}
+
+// ParseUserAgent разбирает строку браузера. Правила покрывают то, что встречается в users.txt,
+// неизвестное получает Other
+func ParseUserAgent(ua string) UserAgent {
+	res := UserAgent{Family: Other, OS: Other}
+
+	for _, r := range uaFamilies {
+		if strings.Contains(ua, r.token) {
+			res.Family = r.family
+			res.Version = r.versionOf(ua)
+			break
+		}
+	}
+	if res.Family == Other && strings.Contains(ua, "Safari") {
+		switch {
+		case strings.Contains(ua, "Android"):
+			res.Family = "Android Browser"
+		case strings.Contains(ua, "Mobile"):
+			res.Family = "Mobile Safari"
+		default:
+			res.Family = "Safari"
+		}
+		res.Version = versionAfter(ua, "Version/")
+	}
+	if res.Family == "Chrome" && strings.Contains(ua, "Mobile") {
+		res.Family = "Chrome Mobile"
+	}
+	if res.Family == "Firefox" && strings.Contains(ua, "Android") {
+		res.Family = "Firefox Mobile"
+	}
+
+	for _, r := range uaOS {
+		if strings.Contains(ua, r.token) {
+			res.OS = r.family
+			res.OSVersion = r.versionOf(ua)
+			break
+		}
+	}
+	if res.OS == "Windows" {
+		res.OSVersion = windowsVersions[res.OSVersion]
+	}
+
+	res.Device = device(ua, &res)
+	return res
+}
+
+func device(ua string, res *UserAgent) string {
+	lower := strings.ToLower(ua)
+	for _, marker := range botMarkers {
+		if strings.Contains(lower, marker) {
+			return DeviceBot
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+		strings.Contains(ua, "PlayBook") || strings.Contains(ua, "Kindle"):
+		return DeviceTablet
+	case strings.Contains(ua, "Mobile") || strings.Contains(ua, "Mobi/") || strings.Contains(ua, "MIDP") ||
+		res.Family == "Opera Mini":
+		return DeviceMobile
+	}
+
+	switch res.OS {
+	case "Android":
+		// планшеты на Android не пишут Mobile
+		return DeviceTablet
+	case "iOS", "Windows Phone", "BlackBerry OS", "Symbian OS", "Palm OS", "webOS", "Windows CE":
+		return DeviceMobile
+	case "Windows", "Mac OS X", "Linux", "Ubuntu", "Chrome OS", "FreeBSD", "NetBSD", "OpenBSD", "Solaris", "OS/2", "BeOS":
+		return DeviceDesktop
+	}
+	return Other
+}
+
+func (r *uaRule) versionOf(ua string) string {
+	if len(r.versions) == 0 {
+		return versionAfter(ua, r.token)
+	}
+	for _, prefix := range r.versions {
+		if v := versionAfter(ua, prefix); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// versionAfter версия major.minor сразу после prefix, "10_6_8" -> "10.6"
+func versionAfter(ua, prefix string) string {
+	idx := strings.Index(ua, prefix)
+	if idx < 0 {
+		return ""
+	}
+	rest := ua[idx+len(prefix):]
+
+	dots, end := 0, 0
+	for ; end < len(rest); end++ {
+		c := rest[end]
+		if c == '.' || c == '_' {
+			if dots++; dots == 2 {
+				break
+			}
+			continue
+		}
+		if c < '0' || c > '9' {
+			break
+		}
+	}
+	version := strings.TrimRight(rest[:end], "._")
+	return strings.Replace(version, "_", ".", -1)
+}
+
+// uaEntry разобранный браузер: поля в []byte для условий и ключи для подсчёта уникальных
+type uaEntry struct {
+	ua            UserAgent
+	family        []byte
+	version       []byte
+	os            []byte
+	device        []byte
+	familyVersion []byte
+}
+
+// uaCacheLimit разных браузеров в users.txt несколько сотен, кеш не даёт разбирать их на каждой строке
+const uaCacheLimit = 1 << 16
+
+var uaCache = struct {
+	sync.RWMutex
+	m map[string]*uaEntry
+}{m: map[string]*uaEntry{}}
+
+func lookupUserAgent(browser []byte) *uaEntry {
+	uaCache.RLock()
+	e, ok := uaCache.m[string(browser)]
+	uaCache.RUnlock()
+	if ok {
+		return e
+	}
+
+	ua := ParseUserAgent(string(browser))
+	e = &uaEntry{
+		ua:            ua,
+		family:        []byte(ua.Family),
+		version:       []byte(ua.Version),
+		os:            []byte(ua.OS),
+		device:        []byte(ua.Device),
+		familyVersion: []byte(strings.TrimSpace(ua.Family + " " + ua.Version)),
+	}
+	uaCache.Lock()
+	if len(uaCache.m) < uaCacheLimit {
+		uaCache.m[string(browser)] = e
+	}
+	uaCache.Unlock()
+	return e
+}
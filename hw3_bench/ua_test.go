@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/moguchev/coursera_go/hw3_bench/models"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	cases := []struct {
+		ua       string
+		expected UserAgent
+	}{
+		{
+			"Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/36.0.1985.67 Safari/537.36",
+			UserAgent{"Chrome", "36.0", "Windows", "7", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 4.3; SPH-L710 Build/JSS15J) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/32.0.1700.99 Mobile Safari/537.36",
+			UserAgent{"Chrome Mobile", "32.0", "Android", "4.3", DeviceMobile},
+		},
+		{
+			"Mozilla/5.0 (Linux; U; Android 2.2; en-us; SCH-I800 Build/FROYO) AppleWebKit/533.1 (KHTML, like Gecko) Version/4.0 Mobile Safari/533.1",
+			UserAgent{"Android Browser", "4.0", "Android", "2.2", DeviceMobile},
+		},
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 9_2 like Mac OS X) AppleWebKit/601.1.46 (KHTML, like Gecko) Version/9.0 Mobile/13C75 Safari/601.1",
+			UserAgent{"Mobile Safari", "9.0", "iOS", "9.2", DeviceMobile},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_6_8) AppleWebKit/535.7 (KHTML, like Gecko) Chrome/16.0.912.36 Safari/535.7",
+			UserAgent{"Chrome", "16.0", "Mac OS X", "10.6", DeviceDesktop},
+		},
+		{
+			"Mozilla/4.0 (compatible; MSIE 6.0; Windows CE; IEMobile 7.11)",
+			UserAgent{"IE Mobile", "7.11", "Windows CE", "", DeviceMobile},
+		},
+		{
+			"Mozilla/5.0 (compatible; MSIE 10.0; Windows NT 6.2; Trident/6.0)",
+			UserAgent{"IE", "10.0", "Windows", "8", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 6.3; Trident/7.0; rv:11.0) like Gecko",
+			UserAgent{"IE", "11.0", "Windows", "8.1", DeviceDesktop},
+		},
+		{
+			"Opera/9.80 (Android; Opera Mini/7.5.33361/31.1543; U; en) Presto/2.8.119 Version/11.1010",
+			UserAgent{"Opera Mini", "7.5", "Android", "", DeviceMobile},
+		},
+		{
+			"Opera/7.50 (Windows XP; U)",
+			UserAgent{"Opera", "7.50", "Windows", "", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (Android; Linux armv7l; rv:10.0.1) Gecko/20100101 Firefox/10.0.1 Fennec/10.0.1",
+			UserAgent{"Firefox Mobile", "10.0", "Android", "", DeviceTablet},
+		},
+		{
+			"Mozilla/5.0 (PlayBook; U; RIM Tablet OS 2.1.0; en-US) AppleWebKit/536.2+ (KHTML like Gecko) Version/7.2.1.0 Safari/536.2+",
+			UserAgent{"Safari", "7.2", "BlackBerry OS", "2.1", DeviceTablet},
+		},
+		{
+			"msnbot/1.1 ( http://search.msn.com/msnbot.htm)",
+			UserAgent{Other, "", Other, "", DeviceBot},
+		},
+		{
+			"HTMLParser/1.6",
+			UserAgent{Other, "", Other, "", Other},
+		},
+		{
+			"",
+			UserAgent{Other, "", Other, "", Other},
+		},
+	}
+	for _, c := range cases {
+		if got := ParseUserAgent(c.ua); got != c.expected {
+			t.Errorf("%q\nGot: %#v\nExpected: %#v", c.ua, got, c.expected)
+		}
+	}
+}
+
+func TestQueryUserAgentFields(t *testing.T) {
+	// "Android" в строке есть, но это не Android: подстрока даёт ложное совпадение
+	user := &models.User{Browsers: []string{
+		"Mozilla/5.0 (Windows NT 6.1) AndroidEmulator/1.0",
+		"Mozilla/4.0 (compatible; MSIE 8.0; Windows NT 5.1)",
+	}}
+	cases := []struct {
+		q     Query
+		match bool
+	}{
+		{androidAndMSIE, true},
+		{And(Equals(FieldOS, "Android"), Equals(FieldBrowserFamily, "IE")), false},
+		{And(Equals(FieldOS, "Windows"), Equals(FieldBrowserFamily, "IE"), Equals(FieldBrowserVersion, "8.0")), true},
+		{Equals(FieldDevice, DeviceDesktop), true},
+		{Equals(FieldDevice, DeviceMobile), false},
+		{mustRegexp(t, FieldBrowserVersion, `^8\.`), true},
+	}
+	for i, c := range cases {
+		if got := c.q.Match(user); got != c.match {
+			t.Errorf("[%d] expected %v, got %v", i, c.match, got)
+		}
+	}
+}
+
+func TestSearchUserAgentFields(t *testing.T) {
+	queries := map[string]Query{
+		"android ie":     And(Equals(FieldOS, "Android"), Equals(FieldBrowserFamily, "IE")),
+		"mobile chrome":  And(Equals(FieldDevice, DeviceMobile), Contains(FieldBrowserFamily, "Chrome")),
+		"old ie or bots": Or(mustRegexp(t, FieldBrowserVersion, `^[5-7]\.`), Equals(FieldDevice, DeviceBot)),
+		"mixed":          And(Contains(FieldBrowser, "Linux"), Not(Equals(FieldOS, "Android"))),
+	}
+	for name, q := range queries {
+		out := new(bytes.Buffer)
+		FastSearchQuery(out, q)
+		if expected := referenceSearch(t, q); out.String() != expected {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", name, out.String(), expected)
+		}
+	}
+}
+
+func TestSearchUniqueBy(t *testing.T) {
+	input := strings.Join([]string{
+		`{"browsers":["Mozilla/5.0 (Windows NT 6.1) Chrome/36.0.1985.67 Safari/537.36","Mozilla/5.0 (X11; Linux) Chrome/36.0.2 Safari/537.36"]}`,
+		`{"browsers":["Mozilla/5.0 (Windows NT 5.1) Chrome/39.0.1 Safari/537.36"]}`,
+		`{"browsers":["Mozilla/5.0 (X11; Linux x86_64; rv:49.0) Gecko/20100101 Firefox/49.0"]}`,
+	}, "\n")
+	q := Or(Equals(FieldBrowserFamily, "Chrome"), Equals(FieldBrowserFamily, "Firefox"))
+
+	for unique, expected := range map[UniqueBy]int{UniqueRaw: 4, UniqueFamily: 2, UniqueFamilyVersion: 3} {
+		for _, workers := range []int{0, 2} {
+			out := new(bytes.Buffer)
+			if err := (&Searcher{Workers: workers, Unique: unique}).Search(strings.NewReader(input), out, q); err != nil {
+				t.Fatal(err)
+			}
+			if suffix := fmt.Sprintf("Total unique browsers %d\n", expected); !strings.HasSuffix(out.String(), suffix) {
+				t.Errorf("[unique %d, workers %d] expected %q, got\n%s", unique, workers, suffix, out)
+			}
+		}
+	}
+}
+
+func BenchmarkParseUserAgent(b *testing.B) {
+	ua := "Mozilla/5.0 (Linux; Android 4.3; SPH-L710 Build/JSS15J) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/32.0.1700.99 Mobile Safari/537.36"
+	for i := 0; i < b.N; i++ {
+		ParseUserAgent(ua)
+	}
+}
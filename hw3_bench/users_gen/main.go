@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/moguchev/coursera_go/hw3_bench/datagen"
+)
+
+// go run ./users_gen -n 100000 -seed 1 -o data/users_100k.txt
+func main() {
+	cfg := datagen.Config{}
+	flag.IntVar(&cfg.Users, "n", 1000, "number of users")
+	flag.Int64Var(&cfg.Seed, "seed", 1, "random seed")
+	flag.Float64Var(&cfg.Adversarial, "adversarial", 0, "share of adversarial lines, 0..1")
+	flag.IntVar(&cfg.Browsers, "browsers", 4, "browsers per regular user")
+	out := flag.String("o", "", "output file, stdout by default")
+	flag.Parse()
+
+	if err := generate(*out, cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate пишет пользователей в path. Файл закрывается до выхода с ошибкой,
+// и ошибка Close не теряется: без неё недописанный файл выглядел бы целым
+func generate(path string, cfg datagen.Config) error {
+	if path == "" {
+		return datagen.Generate(os.Stdout, cfg)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := datagen.Generate(file, cfg); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
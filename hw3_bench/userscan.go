@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// userView строка users.txt, разобранная без аллокаций: срезы смотрят прямо в буфер строки
+// и живут до следующего scan. Память выделяется только под строки с экранированием
+type userView struct {
+	Browsers [][]byte
+	Company  []byte
+	Country  []byte
+	Email    []byte
+	Name     []byte
+}
+
+func (v *userView) reset() {
+	v.Browsers = v.Browsers[:0]
+	v.Company, v.Country, v.Email, v.Name = nil, nil, nil, nil
+}
+
+// clone копия, которая переживёт следующий scan. Сами строки не копируются: они смотрят
+// в строку или в память от unescape, и scan их не перезаписывает
+func (v *userView) clone() userView {
+	c := *v
+	c.Browsers = append([][]byte(nil), v.Browsers...)
+	return c
+}
+
+// scan разбирает объект пользователя. Незнакомые поля пропускаются, не-строковые браузеры
+// игнорируются, как и в SlowSearch
+func (v *userView) scan(line []byte) error {
+	v.reset()
+	l := lexer{data: line}
+	l.skipWS()
+	// null encoding/json разбирает в пустую map
+	if l.peek() == 'n' {
+		if err := l.literal("null"); err != nil {
+			return err
+		}
+		return l.end()
+	}
+	if !l.consume('{') {
+		return l.errorf("expected {")
+	}
+	l.skipWS()
+	if l.consume('}') {
+		return l.end()
+	}
+
+	for {
+		l.skipWS()
+		key, err := l.str()
+		if err != nil {
+			return err
+		}
+		l.skipWS()
+		if !l.consume(':') {
+			return l.errorf("expected :")
+		}
+		l.skipWS()
+
+		switch string(key) {
+		case "browsers":
+			err = v.scanBrowsers(&l)
+		case "company":
+			v.Company, err = l.strOrSkip()
+		case "country":
+			v.Country, err = l.strOrSkip()
+		case "email":
+			v.Email, err = l.strOrSkip()
+		case "name":
+			v.Name, err = l.strOrSkip()
+		default:
+			err = l.skipValue()
+		}
+		if err != nil {
+			return err
+		}
+
+		l.skipWS()
+		if l.consume(',') {
+			continue
+		}
+		if l.consume('}') {
+			return l.end()
+		}
+		return l.errorf("expected , or }")
+	}
+}
+
+func (v *userView) scanBrowsers(l *lexer) error {
+	v.Browsers = v.Browsers[:0]
+	if l.peek() != '[' {
+		return l.skipValue()
+	}
+	l.pos++
+	l.skipWS()
+	if l.consume(']') {
+		return nil
+	}
+	for {
+		l.skipWS()
+		if l.peek() == '"' {
+			browser, err := l.str()
+			if err != nil {
+				return err
+			}
+			v.Browsers = append(v.Browsers, browser)
+		} else if err := l.skipValue(); err != nil {
+			return err
+		}
+
+		l.skipWS()
+		if l.consume(',') {
+			continue
+		}
+		if l.consume(']') {
+			return nil
+		}
+		return l.errorf("expected , or ]")
+	}
+}
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid json at %d: "+format, append([]interface{}{l.pos}, args...)...)
+}
+
+func (l *lexer) peek() byte {
+	if l.pos < len(l.data) {
+		return l.data[l.pos]
+	}
+	return 0
+}
+
+func (l *lexer) consume(c byte) bool {
+	if l.peek() == c {
+		l.pos++
+		return true
+	}
+	return false
+}
+
+func (l *lexer) skipWS() {
+	for l.pos < len(l.data) {
+		switch l.data[l.pos] {
+		case ' ', '\t', '\n', '\r':
+			l.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) end() error {
+	l.skipWS()
+	if l.pos != len(l.data) {
+		return l.errorf("unexpected data after object")
+	}
+	return nil
+}
+
+// str читает строку. Без экранирования возвращает срез исходного буфера.
+// Невалидный utf-8 заменяется на U+FFFD, как в encoding/json
+func (l *lexer) str() ([]byte, error) {
+	if !l.consume('"') {
+		return nil, l.errorf("expected string")
+	}
+	start := l.pos
+	escaped, nonASCII := false, false
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case c == '"':
+			raw := l.data[start:l.pos]
+			l.pos++
+			if escaped || nonASCII && !utf8.Valid(raw) {
+				return unescape(raw)
+			}
+			return raw, nil
+		case c == '\\':
+			escaped = true
+			l.pos += 2
+		case c >= utf8.RuneSelf:
+			nonASCII = true
+			l.pos++
+		case c < 0x20:
+			return nil, l.errorf("control character in string")
+		default:
+			l.pos++
+		}
+	}
+	return nil, l.errorf("unterminated string")
+}
+
+// strOrSkip строковое поле, любое другое значение (null, число) считается пустым
+func (l *lexer) strOrSkip() ([]byte, error) {
+	if l.peek() == '"' {
+		return l.str()
+	}
+	return nil, l.skipValue()
+}
+
+func (l *lexer) skipValue() error {
+	switch c := l.peek(); {
+	case c == '"':
+		_, err := l.strRaw()
+		return err
+	case c == '{' || c == '[':
+		return l.skipNested()
+	case c == 't':
+		return l.literal("true")
+	case c == 'f':
+		return l.literal("false")
+	case c == 'n':
+		return l.literal("null")
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := l.pos
+		for l.pos < len(l.data) && isNumberByte(l.data[l.pos]) {
+			l.pos++
+		}
+		if l.pos == start+1 && c == '-' {
+			return l.errorf("bad number")
+		}
+		return nil
+	default:
+		return l.errorf("unexpected %q", c)
+	}
+}
+
+func isNumberByte(c byte) bool {
+	return c >= '0' && c <= '9' || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E'
+}
+
+// strRaw пропускает строку, не раскодируя её
+func (l *lexer) strRaw() ([]byte, error) {
+	l.pos++
+	start := l.pos
+	for l.pos < len(l.data) {
+		switch l.data[l.pos] {
+		case '"':
+			l.pos++
+			return l.data[start : l.pos-1], nil
+		case '\\':
+			l.pos += 2
+		default:
+			l.pos++
+		}
+	}
+	return nil, l.errorf("unterminated string")
+}
+
+// skipNested пропускает объект или массив целиком, следя только за скобками и строками
+func (l *lexer) skipNested() error {
+	depth := 0
+	for l.pos < len(l.data) {
+		switch l.data[l.pos] {
+		case '"':
+			if _, err := l.strRaw(); err != nil {
+				return err
+			}
+			continue
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				l.pos++
+				return nil
+			}
+		}
+		l.pos++
+	}
+	return l.errorf("unterminated object")
+}
+
+func (l *lexer) literal(lit string) error {
+	if !bytes.HasPrefix(l.data[l.pos:], []byte(lit)) {
+		return l.errorf("expected %s", lit)
+	}
+	l.pos += len(lit)
+	return nil
+}
+
+// unescape раскодирует строку с \-последовательностями и чинит utf-8, здесь единственная аллокация
+func unescape(raw []byte) ([]byte, error) {
+	res := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRune(raw[i:])
+			if r == utf8.RuneError && size == 1 {
+				res = append(res, "\uFFFD"...)
+			} else {
+				res = append(res, raw[i:i+size]...)
+			}
+			i += size - 1
+			continue
+		}
+		if c != '\\' {
+			res = append(res, c)
+			continue
+		}
+		i++
+		if i >= len(raw) {
+			return nil, fmt.Errorf("invalid json: bad escape")
+		}
+		switch raw[i] {
+		case '"', '\\', '/':
+			res = append(res, raw[i])
+		case 'b':
+			res = append(res, '\b')
+		case 'f':
+			res = append(res, '\f')
+		case 'n':
+			res = append(res, '\n')
+		case 'r':
+			res = append(res, '\r')
+		case 't':
+			res = append(res, '\t')
+		case 'u':
+			r, ok := hexRune(raw[i+1:])
+			if !ok {
+				return nil, fmt.Errorf("invalid json: bad \\u escape")
+			}
+			i += 4
+			if utf16.IsSurrogate(r) {
+				r2, ok := rune(-1), false
+				if i+2 < len(raw) && raw[i+1] == '\\' && raw[i+2] == 'u' {
+					r2, ok = hexRune(raw[i+3:])
+				}
+				if dec := utf16.DecodeRune(r, r2); ok && dec != utf8.RuneError {
+					r = dec
+					i += 6
+				} else {
+					r = utf8.RuneError
+				}
+			}
+			var buf [utf8.UTFMax]byte
+			res = append(res, buf[:utf8.EncodeRune(buf[:], r)]...)
+		default:
+			return nil, fmt.Errorf("invalid json: bad escape \\%c", raw[i])
+		}
+	}
+	return res, nil
+}
+
+func hexRune(b []byte) (rune, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range b[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r*16 + rune(c)
+	}
+	return r, true
+}
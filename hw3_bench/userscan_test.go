@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/moguchev/coursera_go/hw3_bench/models"
+)
+
+func viewToUser(v *userView) models.User {
+	u := models.User{
+		Company: string(v.Company),
+		Country: string(v.Country),
+		Email:   string(v.Email),
+		Name:    string(v.Name),
+	}
+	for _, b := range v.Browsers {
+		u.Browsers = append(u.Browsers, string(b))
+	}
+	return u
+}
+
+func TestUserViewScan(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	lines = append(lines,
+		[]byte(` { "name" : "Jo\"hn\\", "email":"a@b.c", "browsers" : [ "Android\t😀" ] } `),
+		[]byte(`{"browsers":null,"job":{"title":["a",{"b":"}"}]},"phone":-1.5e+3,"x":true,"y":false,"z":null}`),
+		[]byte(`{}`),
+		[]byte(`null`),
+		[]byte("{\"name\":\"bad\xffutf8\xc3\",\"browsers\":[\"\xfe\\u0041ndroid\\ud800\"]}"),
+	)
+
+	// без сгенерированных методов: эталон - encoding/json, он же заменяет невалидный utf-8
+	type plainUser models.User
+
+	v := userView{}
+	for i, line := range lines {
+		expected := plainUser{}
+		if err := json.Unmarshal(line, &expected); err != nil {
+			t.Fatalf("[%d] bad test data: %s", i, err)
+		}
+		if err := v.scan(line); err != nil {
+			t.Fatalf("[%d] scan failed: %s", i, err)
+		}
+		if got := viewToUser(&v); !reflect.DeepEqual(got, models.User(expected)) {
+			t.Errorf("[%d] results not match\nGot: %#v\nExpected: %#v", i, got, expected)
+		}
+		user := models.User{}
+		if err := user.UnmarshalJSON(line); err != nil {
+			t.Fatalf("[%d] UnmarshalJSON failed: %s", i, err)
+		}
+		if !reflect.DeepEqual(user, models.User(expected)) {
+			t.Errorf("[%d] UnmarshalJSON not match\nGot: %#v\nExpected: %#v", i, user, expected)
+		}
+	}
+}
+
+func TestUserViewScanLenient(t *testing.T) {
+	v := userView{}
+	if err := v.scan([]byte(`{"browsers":["MSIE",1,null,{"a":1},"Android"],"name":7,"email":null}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := viewToUser(&v); !reflect.DeepEqual(got, models.User{Browsers: []string{"MSIE", "Android"}}) {
+		t.Errorf("non-string values must be skipped, got %#v", got)
+	}
+
+	for _, bad := range []string{``, `{`, `{"a"}`, `{"a":}`, `{"a":1,}`, `{"a":"b`, `{"a":1} x`, `{"name":"\x"}`, `{"browsers":["a" "b"]}`} {
+		if err := v.scan([]byte(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestUserViewScanNoAllocs(t *testing.T) {
+	line := []byte(`{"browsers":["Mozilla/5.0 (Android; Linux armv7l)","Opera/9.80"],"company":"Flashpoint","country":"Peru","email":"a@b.c","job":"x","name":"Sharon","phone":"1"}`)
+	v := userView{}
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := v.scan(line); err != nil {
+			t.Fatal(err)
+		}
+		if androidAndMSIE.matchView(&v) {
+			t.Fatal("must not match")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("expected 0 allocs, got %v", allocs)
+	}
+}
+
+// go test -bench UserView -benchmem
+
+func BenchmarkUserViewScan(b *testing.B) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	v := userView{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			if err := v.scan(line); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkUserUnmarshalJSON(b *testing.B) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	user := models.User{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			if err := user.UnmarshalJSON(line); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
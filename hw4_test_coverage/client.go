@@ -1,9 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -19,9 +19,14 @@ const (
 
 var (
 	errTest = errors.New("testing")
-	client  = &http.Client{Timeout: time.Second}
 )
 
+// MaxLimit больше стольких пользователей за раз FindUsers не вернёт
+const MaxLimit = 25
+
+// defaultTimeout таймаут запроса, если в SearchClient он не задан
+const defaultTimeout = time.Second
+
 type User struct {
 	Id     int
 	Name   string
@@ -52,7 +57,7 @@ type SearchRequest struct {
 	Offset     int    // Можно учесть после сортировки
 	Query      string // подстрока в 1 из полей
 	OrderField string
-	// -1 по убыванию, 0 как встретилось, 1 по возрастанию
+	// OrderByAsc (-1) по возрастанию, OrderByAsIs (0) как встретилось, OrderByDesc (1) по убыванию
 	OrderBy int
 }
 
@@ -61,75 +66,109 @@ type SearchClient struct {
 	AccessToken string
 	// урл внешней системы, куда идти
 	URL string
+	// Transport через что ходить во внешнюю систему, nil - http.DefaultTransport
+	Transport http.RoundTripper
+	// Timeout на весь запрос вместе с чтением ответа, 0 - defaultTimeout
+	Timeout time.Duration
+	// Header заголовки, которые уходят с каждым запросом. AccessToken ставится поверх них
+	Header http.Header
+	// Retry повторы при таймаутах, 5xx и разрывах соединения, по умолчанию их нет
+	Retry RetryPolicy
+	// Breaker если не nil, после череды неудач запросы сразу завершаются с ErrCircuitOpen.
+	// Один Breaker можно делить между несколькими клиентами одной внешней системы
+	Breaker *CircuitBreaker
+	// OnAttempt если не nil, вызывается после каждой попытки, например чтобы её залогировать
+	OnAttempt func(Attempt)
+}
+
+func (srv *SearchClient) httpClient() *http.Client {
+	timeout := srv.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	return &http.Client{Transport: srv.Transport, Timeout: timeout}
 }
 
 // FindUsers отправляет запрос во внешнюю систему, которая непосредственно ищет пользоваталей
 func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
+	return srv.FindUsersContext(context.Background(), req)
+}
+
+// FindUsersContext то же, что FindUsers, но запрос прерывается, когда ctx отменён или истёк
+func (srv *SearchClient) FindUsersContext(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
 	// валидация и нормализация
 	if req.Limit < 0 {
-		return nil, fmt.Errorf("limit must be > 0")
+		return nil, &SearchError{Err: ErrBadLimit, Request: req}
 	}
-	if req.Limit > 25 {
-		req.Limit = 25
+	if req.Limit > MaxLimit {
+		req.Limit = MaxLimit
 	}
 	if req.Offset < 0 {
-		return nil, fmt.Errorf("offset must be > 0")
+		return nil, &SearchError{Err: ErrBadOffset, Request: req}
+	}
+	return srv.findWithRetry(ctx, req)
+}
+
+// findUsersOnce один запрос во внешнюю систему, req уже нормализован
+func (srv *SearchClient) findUsersOnce(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	fail := func(status int, kind, cause error) (*SearchResponse, error) {
+		return nil, &SearchError{Err: kind, Cause: cause, StatusCode: status, Request: req}
 	}
 
 	// нужно для получения следующей записи, на основе которой мы скажем - можно показать переключатель следующей страницы или нет
-	req.Limit++
+	limit := req.Limit + 1
 
 	searcherParams := url.Values{}
-	searcherParams.Add("limit", strconv.Itoa(req.Limit))
+	searcherParams.Add("limit", strconv.Itoa(limit))
 	searcherParams.Add("offset", strconv.Itoa(req.Offset))
 	searcherParams.Add("query", req.Query)
 	searcherParams.Add("order_field", req.OrderField)
 	searcherParams.Add("order_by", strconv.Itoa(req.OrderBy))
 
-	searcherReq, err := http.NewRequest(http.MethodGet, srv.URL+"?"+searcherParams.Encode(), nil)
+	searcherReq, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?"+searcherParams.Encode(), nil)
 	if err != nil {
-		return nil, err
+		return fail(0, ErrUnknown, err)
 	}
-	searcherReq.Header.Add("AccessToken", srv.AccessToken)
+	for key, values := range srv.Header {
+		searcherReq.Header[key] = append([]string(nil), values...)
+	}
+	searcherReq.Header.Set("AccessToken", srv.AccessToken)
 
-	resp, err := client.Do(searcherReq)
+	resp, err := srv.httpClient().Do(searcherReq)
 	if err != nil {
-		if err, ok := err.(net.Error); ok && err.Timeout() {
-			return nil, fmt.Errorf("timeout for %s", searcherParams.Encode())
-		}
-		return nil, fmt.Errorf("unknown error %s", err)
+		return fail(0, transportError(ctx, err), err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return fail(resp.StatusCode, transportError(ctx, err), err)
 	}
 
-	switch resp.StatusCode {
-	case http.StatusUnauthorized:
-		return nil, fmt.Errorf("bad access token")
-	case http.StatusInternalServerError:
-		return nil, fmt.Errorf("fatal error")
-	case http.StatusBadRequest:
+	switch status := resp.StatusCode; {
+	case status == http.StatusUnauthorized:
+		return fail(status, ErrUnauthorized, nil)
+	case status >= http.StatusInternalServerError:
+		return fail(status, ErrServer, nil)
+	case status == http.StatusBadRequest:
 		errResp := SearchErrorResponse{}
 		if err = json.Unmarshal(body, &errResp); err != nil {
-			return nil, fmt.Errorf("cant unpack error json: %s", err)
+			return fail(status, ErrBadErrorResponse, err)
 		}
 		if errResp.Error == "ErrorBadOrderField" {
-			return nil, fmt.Errorf("OrderFeld %s invalid", req.OrderField)
+			return fail(status, &BadOrderFieldError{Field: req.OrderField}, nil)
 		}
 
-		return nil, fmt.Errorf("unknown bad request error: %s", errResp.Error)
+		return fail(status, ErrBadRequest, errors.New(errResp.Error))
 	}
 
 	data := []User{}
 	if err = json.Unmarshal(body, &data); err != nil {
-		return nil, fmt.Errorf("cant unpack result json: %s", err)
+		return fail(resp.StatusCode, ErrBadResponse, err)
 	}
 
 	result := SearchResponse{}
-	if len(data) == req.Limit {
+	if len(data) == limit {
 		result.NextPage = true
 		result.Users = data[0 : len(data)-1]
 	} else {
@@ -138,3 +177,14 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 
 	return &result, err
 }
+
+// transportError вид ошибки, если ответа не дождались: отмена вызывающим - не ошибка внешней системы
+func transportError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err, ok := err.(net.Error); ok && err.Timeout() {
+		return ErrTimeout
+	}
+	return ErrUnknown
+}
@@ -5,117 +5,67 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"encoding/xml"
+	"errors"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
-	"strconv"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
-)
 
-const (
-	datasetPath = "./dataset.xml"
-	offset      = "offset"
-	limit       = "limit"
-	pageSize    = 25
+	"github.com/moguchev/coursera_go/hw4_test_coverage/searchserver"
 )
 
-type XMLRow struct {
-	ID        int    `xml:"id"`
-	Age       int    `xml:"age"`
-	FirstName string `xml:"first_name"`
-	LastName  string `xml:"last_name"`
-	Gender    string `xml:"gender"`
-	About     string `xml:"about"`
-}
-
-type XMLStructure struct {
-	Version string   `xml:"version"`
-	Row     []XMLRow `xml:"row"`
-}
+const datasetPath = "./dataset.xml"
 
+// SearchServer настоящий поиск по dataset.xml и подделки, которые отвечают ошибками
 type SearchServer struct {
-	repo *Repository
-}
-
-type Repository struct {
-	DB string
+	search *searchserver.Server
 }
 
 var server *SearchServer
 
 func init() {
-	server = &SearchServer{
-		repo: &Repository{DB: datasetPath},
+	search, err := searchserver.Load(datasetPath, "")
+	if err != nil {
+		panic(err)
 	}
+	server = &SearchServer{search: search}
 }
 
-func (r *Repository) GetUsers(ctx context.Context) ([]User, error) {
-	data, err := os.ReadFile(r.DB)
+// datasetUsers все пользователи dataset.xml в порядке файла
+func datasetUsers(t *testing.T) []User {
+	file, err := os.Open(datasetPath)
 	if err != nil {
-		return nil, err
+		t.Fatal(err)
 	}
-
-	usersXML := &XMLStructure{}
-	err = xml.Unmarshal(data, &usersXML)
+	defer file.Close()
+	loaded, err := searchserver.LoadDataset(file)
 	if err != nil {
-		return nil, err
+		t.Fatal(err)
 	}
-
-	users := []User{}
-	for _, user := range usersXML.Row {
-		users = append(users, User{
-			Id:     user.ID,
-			Name:   user.FirstName + user.LastName,
-			Age:    user.Age,
-			About:  user.About,
-			Gender: user.Gender,
-		})
+	users := make([]User, len(loaded))
+	for i, u := range loaded {
+		users[i] = User(u)
 	}
-	return users, nil
+	return users
 }
 
 func (s *SearchServer) Success(w http.ResponseWriter, r *http.Request) {
-	users, err := s.repo.GetUsers(r.Context())
-	if err != nil {
-		panic(err) // not in production
-	}
-
-	offset, _ := strconv.Atoi(r.FormValue(offset))
-	limit, _ := strconv.Atoi(r.FormValue(limit))
-
-	startRow := 0
-	if offset > 0 {
-		startRow = offset * pageSize
-	}
-
-	endRow := startRow + limit
-	users = users[startRow:endRow]
-
-	res, err := json.Marshal(users)
-	if err != nil {
-		panic(err) // not in production
-	}
-
-	w.WriteHeader(http.StatusOK)
-	w.Write(res)
+	s.search.ServeHTTP(w, r)
 }
 
+// LimitFail отдаёт всех пользователей, сколько бы ни попросили
 func (s *SearchServer) LimitFail(w http.ResponseWriter, r *http.Request) {
-	users, err := s.repo.GetUsers(r.Context())
-	if err != nil {
-		panic(err) // not in production
-	}
-
-	res, err := json.Marshal(users)
-	if err != nil {
-		panic(err) // not in production
-	}
-
-	w.WriteHeader(http.StatusOK)
-	w.Write(res)
+	params := r.URL.Query()
+	params.Set("limit", "1000")
+	r.URL.RawQuery = params.Encode()
+	s.search.ServeHTTP(w, r)
 }
 
 func (s *SearchServer) JSONFail(w http.ResponseWriter, r *http.Request) {
@@ -128,6 +78,11 @@ func (s *SearchServer) TimeoutError(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// Hang отвечает, только когда клиент ушёл
+func (s *SearchServer) Hang(w http.ResponseWriter, r *http.Request) {
+	<-r.Context().Done()
+}
+
 func (s *SearchServer) UnknownError(w http.ResponseWriter, r *http.Request) {}
 
 func (s *SearchServer) Unauthorized(w http.ResponseWriter, r *http.Request) {
@@ -319,3 +274,271 @@ func TestBadRequestError(t *testing.T) {
 
 	ts.Close()
 }
+
+func TestFindUsersContextCancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(server.Hang))
+	defer ts.Close()
+	searchClient := &SearchClient{URL: ts.URL, Timeout: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := searchClient.FindUsersContext(ctx, SearchRequest{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("request was not cancelled")
+	}
+}
+
+func TestTimeoutOption(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(server.Hang))
+	defer ts.Close()
+	searchClient := &SearchClient{URL: ts.URL, Timeout: 20 * time.Millisecond}
+
+	start := time.Now()
+	_, err := searchClient.FindUsers(SearchRequest{})
+	if err == nil || time.Since(start) > time.Second {
+		t.Errorf("expected fast timeout, got %v after %s", err, time.Since(start))
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestTransportAndHeader(t *testing.T) {
+	var got *http.Request
+	searchClient := &SearchClient{
+		URL:         "http://search.local/users",
+		AccessToken: "token",
+		Header:      http.Header{"X-Request-Id": {"42"}, "Accesstoken": {"base"}},
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			got = r
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(strings.NewReader(`[{"Id":1}]`)),
+				Request:    r,
+			}, nil
+		}),
+	}
+
+	resp, err := searchClient.FindUsers(SearchRequest{Limit: 1, Query: "on"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Users) != 1 || resp.NextPage {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if got.Header.Get("X-Request-Id") != "42" || got.Header.Get("AccessToken") != "token" {
+		t.Errorf("unexpected headers %v", got.Header)
+	}
+	if got.URL.Host != "search.local" || got.URL.Query().Get("query") != "on" || got.URL.Query().Get("limit") != "2" {
+		t.Errorf("unexpected url %s", got.URL)
+	}
+	if searchClient.Header.Get("AccessToken") != "base" {
+		t.Error("base headers must not be modified")
+	}
+}
+
+func TestBadURL(t *testing.T) {
+	searchClient := &SearchClient{
+		URL: "http://search.local/\x7f",
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			t.Error("request with bad url must not be sent")
+			return nil, errors.New("unexpected request")
+		}),
+	}
+	_, err := searchClient.FindUsers(SearchRequest{})
+	urlErr := &url.Error{}
+	if !errors.Is(err, ErrUnknown) || !errors.As(err, &urlErr) {
+		t.Errorf("expected ErrUnknown with *url.Error cause, got %v", err)
+	}
+}
+
+// timeoutError сетевой таймаут, как его отдаёт net
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// brokenBody отдаёт начало ответа, потом обрывается
+type brokenBody struct {
+	data io.Reader
+}
+
+func (b brokenBody) Read(p []byte) (int, error) {
+	if n, _ := b.data.Read(p); n > 0 {
+		return n, nil
+	}
+	return 0, timeoutError{}
+}
+
+func (brokenBody) Close() error { return nil }
+
+func TestBodyReadError(t *testing.T) {
+	searchClient := &SearchClient{
+		URL: "http://search.local/users",
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       brokenBody{strings.NewReader(`[{"Id":1},`)},
+				Request:    r,
+			}, nil
+		}),
+	}
+	_, err := searchClient.FindUsers(SearchRequest{Limit: 1})
+	searchErr := &SearchError{}
+	if !errors.Is(err, ErrTimeout) || !errors.As(err, &searchErr) || searchErr.StatusCode != http.StatusOK {
+		t.Errorf("expected ErrTimeout with status 200, got %v", err)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		kind    error
+		status  int
+	}{
+		{"unauthorized", server.Unauthorized, ErrUnauthorized, http.StatusUnauthorized},
+		{"server", server.InternalServerError, ErrServer, http.StatusInternalServerError},
+		{"bad error json", server.BadRequest, ErrBadErrorResponse, http.StatusBadRequest},
+		{"bad order field", server.BadField, ErrBadRequest, http.StatusBadRequest},
+		{"unknown bad request", server.BadError, ErrBadRequest, http.StatusBadRequest},
+		{"bad json", server.JSONFail, ErrBadResponse, http.StatusOK},
+		{"timeout", server.Hang, ErrTimeout, 0},
+	}
+	req := SearchRequest{Limit: 100, Offset: 3, Query: "q", OrderField: "Age", OrderBy: OrderByDesc}
+	for _, c := range cases {
+		ts := httptest.NewServer(c.handler)
+		searchClient := &SearchClient{URL: ts.URL, Timeout: 50 * time.Millisecond}
+		_, err := searchClient.FindUsers(req)
+		ts.Close()
+
+		if !errors.Is(err, c.kind) {
+			t.Errorf("[%s] expected %v, got %v", c.name, c.kind, err)
+			continue
+		}
+		searchErr := &SearchError{}
+		if !errors.As(err, &searchErr) {
+			t.Errorf("[%s] expected *SearchError, got %T", c.name, err)
+			continue
+		}
+		expectedReq := req
+		expectedReq.Limit = 25
+		if searchErr.StatusCode != c.status || searchErr.Request != expectedReq {
+			t.Errorf("[%s] got status %d, request %+v", c.name, searchErr.StatusCode, searchErr.Request)
+		}
+	}
+}
+
+func TestTypedErrorCauses(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(server.BadField))
+	_, err := (&SearchClient{URL: ts.URL}).FindUsers(SearchRequest{OrderField: "Salary"})
+	ts.Close()
+	orderErr := &BadOrderFieldError{}
+	if !errors.As(err, &orderErr) || orderErr.Field != "Salary" {
+		t.Errorf("expected *BadOrderFieldError, got %v", err)
+	}
+
+	ts = httptest.NewServer(http.HandlerFunc(server.JSONFail))
+	_, err = (&SearchClient{URL: ts.URL}).FindUsers(SearchRequest{})
+	ts.Close()
+	syntaxErr := &json.SyntaxError{}
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("expected *json.SyntaxError cause, got %v", err)
+	}
+
+	ts = httptest.NewServer(http.HandlerFunc(server.Hang))
+	_, err = (&SearchClient{URL: ts.URL, Timeout: 20 * time.Millisecond}).FindUsers(SearchRequest{})
+	ts.Close()
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("expected net.Error cause, got %v", err)
+	}
+
+	_, err = (&SearchClient{}).FindUsers(SearchRequest{Limit: -1})
+	if !errors.Is(err, ErrBadLimit) || errors.Is(err, ErrBadOffset) {
+		t.Errorf("expected ErrBadLimit, got %v", err)
+	}
+}
+
+func TestFindUsersSearchServer(t *testing.T) {
+	search, err := searchserver.Load(datasetPath, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(search)
+	defer ts.Close()
+	searchClient := &SearchClient{URL: ts.URL, AccessToken: "secret"}
+
+	resp, err := searchClient.FindUsers(SearchRequest{Limit: 3, Offset: 1, OrderField: "Age", OrderBy: OrderByDesc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Users) != 3 || !resp.NextPage {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	for i := 1; i < len(resp.Users); i++ {
+		if resp.Users[i-1].Age < resp.Users[i].Age {
+			t.Errorf("users are not ordered by age desc: %+v", resp.Users)
+		}
+	}
+
+	// имя и фамилия склеены без пробела, как в исходном датасете клиента
+	resp, err = searchClient.FindUsers(SearchRequest{Limit: 25, Query: "BoydWolf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Users) != 1 || resp.Users[0].Name != "BoydWolf" || resp.NextPage {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	_, err = searchClient.FindUsers(SearchRequest{OrderField: "Gender"})
+	orderErr := &BadOrderFieldError{}
+	if !errors.As(err, &orderErr) || orderErr.Field != "Gender" {
+		t.Errorf("expected *BadOrderFieldError, got %v", err)
+	}
+
+	_, err = (&SearchClient{URL: ts.URL, AccessToken: "wrong"}).FindUsers(SearchRequest{})
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+// TestOrderByDirection направление сортировки задаётся именами констант, а не числами
+func TestOrderByDirection(t *testing.T) {
+	if OrderByAsc != searchserver.OrderByAsc || OrderByAsIs != searchserver.OrderByAsIs || OrderByDesc != searchserver.OrderByDesc {
+		t.Fatal("client and searchserver order_by values differ")
+	}
+	search, err := searchserver.Load(datasetPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(search)
+	defer ts.Close()
+	searchClient := &SearchClient{URL: ts.URL}
+
+	ids := func(orderBy int) []int {
+		resp, err := searchClient.FindUsers(SearchRequest{Limit: 5, OrderField: "Id", OrderBy: orderBy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := []int{}
+		for _, u := range resp.Users {
+			res = append(res, u.Id)
+		}
+		return res
+	}
+	if got := ids(OrderByAsc); !reflect.DeepEqual(got, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("OrderByAsc must sort ascending, got %v", got)
+	}
+	if got := ids(OrderByDesc); !reflect.DeepEqual(got, []int{34, 33, 32, 31, 30}) {
+		t.Errorf("OrderByDesc must sort descending, got %v", got)
+	}
+}
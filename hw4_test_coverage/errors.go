@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Виды ошибок FindUsers, проверяются через errors.Is
+var (
+	ErrBadLimit  = errors.New("limit must be > 0")
+	ErrBadOffset = errors.New("offset must be > 0")
+
+	// ErrTimeout внешняя система не ответила за SearchClient.Timeout
+	ErrTimeout = errors.New("timeout")
+	// ErrUnknown не удалось достучаться до внешней системы
+	ErrUnknown = errors.New("unknown error")
+	// ErrUnauthorized внешняя система не приняла AccessToken
+	ErrUnauthorized = errors.New("Bad AccessToken")
+	// ErrServer внешняя система ответила 5xx
+	ErrServer = errors.New("SearchServer fatal error")
+	// ErrBadRequest внешняя система ответила 400, см. также BadOrderFieldError
+	ErrBadRequest = errors.New("unknown bad request error")
+	// ErrBadResponse ответ с результатом не разобрать
+	ErrBadResponse = errors.New("cant unpack result json")
+	// ErrBadErrorResponse ответ 400 с описанием ошибки не разобрать
+	ErrBadErrorResponse = errors.New("cant unpack error json")
+)
+
+// SearchError ошибка FindUsers: что случилось, с каким запросом и статусом ответа.
+// errors.Is и errors.As смотрят и на вид ошибки Err, и на причину Cause:
+//
+//	if errors.Is(err, ErrTimeout) { ... }
+//	var netErr net.Error
+//	if errors.As(err, &netErr) { ... }
+type SearchError struct {
+	// Err вид ошибки: одна из Err* выше, *BadOrderFieldError или ошибка контекста
+	Err error
+	// Cause исходная ошибка сети или разбора json, может быть nil
+	Cause error
+	// StatusCode статус ответа внешней системы, 0 - ответа не было
+	StatusCode int
+	// Request запрос после нормализации: Limit уже не больше MaxLimit
+	Request SearchRequest
+}
+
+func (e *SearchError) Error() string {
+	if e.Cause == nil {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + e.Cause.Error()
+}
+
+// Unwrap причина ошибки
+func (e *SearchError) Unwrap() error {
+	return e.Cause
+}
+
+// Is совпадает ли вид ошибки с target
+func (e *SearchError) Is(target error) bool {
+	return errors.Is(e.Err, target)
+}
+
+// As достаёт вид ошибки, например *BadOrderFieldError
+func (e *SearchError) As(target interface{}) bool {
+	return errors.As(e.Err, target)
+}
+
+// BadOrderFieldError внешняя система не умеет сортировать по полю Field.
+// Это частный случай ErrBadRequest
+type BadOrderFieldError struct {
+	Field string
+}
+
+func (e *BadOrderFieldError) Error() string {
+	return fmt.Sprintf("OrderFeld %s invalid", e.Field)
+}
+
+// Is BadOrderFieldError - это ещё и ErrBadRequest
+func (e *BadOrderFieldError) Is(target error) bool {
+	return target == ErrBadRequest
+}
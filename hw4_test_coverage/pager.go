@@ -0,0 +1,111 @@
+package main
+
+import "context"
+
+// Pager обходит всех пользователей запроса страница за страницей, следующая страница
+// запрашивается, только когда дочитана текущая:
+//
+//	p := client.NewPager(ctx, SearchRequest{Query: "Boyd"})
+//	defer p.Close()
+//	for p.Next() {
+//		user := p.User()
+//	}
+//	if err := p.Err(); err != nil { ... }
+type Pager struct {
+	// Prefetch следующая страница запрашивается в фоне, пока читается текущая
+	Prefetch bool
+
+	client *SearchClient
+	ctx    context.Context
+	cancel context.CancelFunc
+	// req запрос следующей страницы
+	req   SearchRequest
+	users []User
+	user  User
+	// next страница, которая уже запрошена в фоне
+	next chan pageResult
+	done bool
+	err  error
+}
+
+type pageResult struct {
+	resp *SearchResponse
+	err  error
+}
+
+// NewPager обходит пользователей req начиная с req.Offset страницами по req.Limit,
+// 0 или больше MaxLimit - по MaxLimit
+func (srv *SearchClient) NewPager(ctx context.Context, req SearchRequest) *Pager {
+	if req.Limit == 0 || req.Limit > MaxLimit {
+		req.Limit = MaxLimit
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &Pager{client: srv, ctx: ctx, cancel: cancel, req: req}
+}
+
+// Next переходит к следующему пользователю, false - пользователи кончились или случилась ошибка
+func (p *Pager) Next() bool {
+	for len(p.users) == 0 {
+		if p.done {
+			return false
+		}
+		resp, err := p.page()
+		if err != nil {
+			p.err = err
+			p.finish()
+			return false
+		}
+		p.users = resp.Users
+		p.req.Offset += len(resp.Users)
+		// пустая страница с NextPage - сломанный сервер, иначе обход не кончится
+		if !resp.NextPage || len(resp.Users) == 0 {
+			p.finish()
+		} else if p.Prefetch {
+			p.prefetch()
+		}
+	}
+	p.user, p.users = p.users[0], p.users[1:]
+	return true
+}
+
+// User текущий пользователь, годится после Next, вернувшего true
+func (p *Pager) User() User {
+	return p.user
+}
+
+// Err ошибка, на которой остановился обход
+func (p *Pager) Err() error {
+	return p.err
+}
+
+// Close прекращает обход и отменяет запрос страницы в фоне. Обход до конца закрывает Pager сам
+func (p *Pager) Close() {
+	p.users = nil
+	p.finish()
+}
+
+// finish больше страниц не запрашивать, уже полученные пользователи ещё отдаются
+func (p *Pager) finish() {
+	p.done = true
+	p.cancel()
+}
+
+func (p *Pager) page() (*SearchResponse, error) {
+	if p.next != nil {
+		res := <-p.next
+		p.next = nil
+		return res.resp, res.err
+	}
+	return p.client.FindUsersContext(p.ctx, p.req)
+}
+
+func (p *Pager) prefetch() {
+	// буфер на один результат: горутина не зависнет, даже если его никто не заберёт
+	next := make(chan pageResult, 1)
+	req := p.req
+	go func() {
+		resp, err := p.client.FindUsersContext(p.ctx, req)
+		next <- pageResult{resp, err}
+	}()
+	p.next = next
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// pagedHandler настоящий поиск, но с offset >= failFrom отвечает 500.
+// Каждый запрошенный offset уходит в offsets
+func pagedHandler(t *testing.T, failFrom int, offsets chan<- int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.FormValue("offset"))
+		if offsets != nil {
+			offsets <- offset
+		}
+		if offset >= failFrom {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		server.Success(w, r)
+	}
+}
+
+func TestPager(t *testing.T) {
+	all := datasetUsers(t)
+	ts := httptest.NewServer(pagedHandler(t, len(all)+1, nil))
+	defer ts.Close()
+	searchClient := &SearchClient{URL: ts.URL}
+
+	for _, req := range []SearchRequest{{}, {Limit: 7}, {Limit: 100, Offset: 3}, {Limit: 1, Offset: 30}, {Offset: len(all)}} {
+		for _, prefetch := range []bool{false, true} {
+			p := searchClient.NewPager(context.Background(), req)
+			p.Prefetch = prefetch
+			got := []User{}
+			for p.Next() {
+				got = append(got, p.User())
+			}
+			if err := p.Err(); err != nil {
+				t.Fatalf("%+v: %s", req, err)
+			}
+			expected := all[req.Offset:]
+			if len(got) != len(expected) {
+				t.Fatalf("%+v prefetch=%v: got %d users, expected %d", req, prefetch, len(got), len(expected))
+			}
+			for i := range got {
+				if got[i] != expected[i] {
+					t.Errorf("%+v prefetch=%v: [%d] got %+v, expected %+v", req, prefetch, i, got[i], expected[i])
+				}
+			}
+		}
+	}
+}
+
+func TestPagerError(t *testing.T) {
+	ts := httptest.NewServer(pagedHandler(t, 10, nil))
+	defer ts.Close()
+	searchClient := &SearchClient{URL: ts.URL}
+
+	for _, prefetch := range []bool{false, true} {
+		p := searchClient.NewPager(context.Background(), SearchRequest{Limit: 5})
+		p.Prefetch = prefetch
+		n := 0
+		for p.Next() {
+			n++
+		}
+		if n != 10 || !errors.Is(p.Err(), ErrServer) {
+			t.Errorf("prefetch=%v: got %d users and error %v", prefetch, n, p.Err())
+		}
+		if p.Next() {
+			t.Error("Next after error must be false")
+		}
+	}
+
+	p := searchClient.NewPager(context.Background(), SearchRequest{Limit: -1})
+	if p.Next() || !errors.Is(p.Err(), ErrBadLimit) {
+		t.Errorf("expected ErrBadLimit, got %v", p.Err())
+	}
+}
+
+func TestPagerPrefetch(t *testing.T) {
+	offsets := make(chan int, 10)
+	ts := httptest.NewServer(pagedHandler(t, 1000, offsets))
+	defer ts.Close()
+	searchClient := &SearchClient{URL: ts.URL}
+
+	p := searchClient.NewPager(context.Background(), SearchRequest{Limit: 10})
+	p.Prefetch = true
+	if !p.Next() {
+		t.Fatal(p.Err())
+	}
+	// вторая страница запрашивается, хотя первая ещё не дочитана
+	for _, expected := range []int{0, 10} {
+		select {
+		case got := <-offsets:
+			if got != expected {
+				t.Errorf("got offset %d, expected %d", got, expected)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("page with offset %d was not requested", expected)
+		}
+	}
+	p.Close()
+	if p.Next() || p.Err() != nil {
+		t.Errorf("closed pager: got error %v", p.Err())
+	}
+
+	p = searchClient.NewPager(context.Background(), SearchRequest{Limit: 10})
+	p.Next()
+	select {
+	case <-offsets:
+	case <-time.After(time.Second):
+		t.Fatal("first page was not requested")
+	}
+	select {
+	case got := <-offsets:
+		t.Errorf("page with offset %d requested without prefetch", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+	p.Close()
+}
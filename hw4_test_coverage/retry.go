@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrCircuitOpen запрос не отправлялся: внешняя система недавно падала раз за разом
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// RetryPolicy когда повторять запрос. Поиск - идемпотентный GET, так что повторять его безопасно.
+// Повторяются только таймауты, 5xx и разорванные соединения: на 4xx и плохой json
+// внешняя система ответит так же
+type RetryPolicy struct {
+	// MaxAttempts сколько всего попыток, <= 1 - без повторов
+	MaxAttempts int
+	// BaseDelay пауза после первой неудачи, дальше каждый раз удваивается
+	BaseDelay time.Duration
+	// MaxDelay больше этого пауза не растёт, 0 - без ограничения
+	MaxDelay time.Duration
+}
+
+// delay пауза после failures неудач подряд. Вторая половина паузы случайная,
+// чтобы клиенты, упавшие вместе, не повторяли запросы хором
+func (p RetryPolicy) delay(failures int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < failures && (p.MaxDelay == 0 || d < p.MaxDelay) && d < time.Hour; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d-d/2)+1))
+}
+
+// Attempt чем закончилась одна попытка запроса
+type Attempt struct {
+	Request SearchRequest
+	// Number номер попытки, с 1
+	Number int
+	// Err ошибка попытки, nil - успех
+	Err error
+	// Duration сколько шла попытка
+	Duration time.Duration
+	// Retry будет ли ещё попытка, через Delay
+	Retry bool
+	Delay time.Duration
+}
+
+// retryable стоит ли повторить запрос после err. Разомкнутую цепь повторять бесполезно:
+// запросы не уйдут, пока не пройдёт Cooldown
+func retryable(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	return errors.Is(err, ErrTimeout) || errors.Is(err, ErrServer) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func (srv *SearchClient) findWithRetry(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	for n := 1; ; n++ {
+		start := time.Now()
+		resp, err := srv.attempt(ctx, req)
+
+		retry := err != nil && n < srv.Retry.MaxAttempts && retryable(err)
+		delay := time.Duration(0)
+		if retry {
+			delay = srv.Retry.delay(n)
+			// цепь не замкнётся и после паузы: ждать нечего, повтор сразу вернёт ErrCircuitOpen
+			if srv.Breaker != nil && srv.Breaker.openAt(time.Now().Add(delay)) {
+				delay = 0
+			}
+		}
+		if srv.OnAttempt != nil {
+			srv.OnAttempt(Attempt{Request: req, Number: n, Err: err, Duration: time.Since(start), Retry: retry, Delay: delay})
+		}
+		if !retry {
+			return resp, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, &SearchError{Err: ctx.Err(), Cause: err, Request: req}
+		}
+	}
+}
+
+// attempt одна попытка через Breaker, если он есть
+func (srv *SearchClient) attempt(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	if srv.Breaker == nil {
+		return srv.findUsersOnce(ctx, req)
+	}
+	ok, probe := srv.Breaker.allow()
+	if !ok {
+		return nil, &SearchError{Err: ErrCircuitOpen, Request: req}
+	}
+	resp, err := srv.findUsersOnce(ctx, req)
+	srv.Breaker.report(ctx, probe, err)
+	return resp, err
+}
+
+// CircuitBreaker после Threshold неудач подряд на время Cooldown перестаёт пускать запросы.
+// Потом пропускает один пробный: если он прошёл, запросы снова идут, если нет - ещё Cooldown.
+// Неудачи - то же, что повторяет RetryPolicy; 4xx значат, что внешняя система жива
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow можно ли сейчас отправить запрос и будет ли он пробным
+func (b *CircuitBreaker) allow() (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.Threshold || b.Threshold <= 0 {
+		return true, false
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false, false
+	}
+	b.probing = true
+	return true, true
+}
+
+// openAt будет ли цепь ещё разомкнута в момент t
+func (b *CircuitBreaker) openAt(t time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Threshold > 0 && b.failures >= b.Threshold && t.Before(b.openUntil)
+}
+
+// report итог запроса, пропущенного allow
+func (b *CircuitBreaker) report(ctx context.Context, probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// отменил вызывающий, о внешней системе ничего не узнали
+	case err != nil && retryable(err):
+		b.failures++
+		if b.failures >= b.Threshold {
+			b.openUntil = time.Now().Add(b.Cooldown)
+		}
+	default:
+		b.failures = 0
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyHandler первые fails запросов падают через fail, остальные отвечают пустым списком
+func flakyHandler(fails int32, fail http.HandlerFunc) (http.HandlerFunc, *int32) {
+	calls := new(int32)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) <= fails {
+			fail(w, r)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}, calls
+}
+
+// resetConnection рвёт соединение, не ответив
+func resetConnection(w http.ResponseWriter, r *http.Request) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		panic(err)
+	}
+	conn.Close()
+}
+
+func TestRetry(t *testing.T) {
+	retry := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	cases := []struct {
+		name      string
+		fails     int32
+		fail      http.HandlerFunc
+		calls     int32
+		expectErr error
+	}{
+		{"500", 2, server.InternalServerError, 3, nil},
+		{"500 exhausted", 5, server.InternalServerError, 3, ErrServer},
+		{"timeout", 1, server.Hang, 2, nil},
+		{"connection reset", 2, resetConnection, 3, nil},
+		{"unauthorized", 5, server.Unauthorized, 1, ErrUnauthorized},
+		{"bad request", 5, server.BadField, 1, ErrBadRequest},
+		{"bad json", 5, server.JSONFail, 1, ErrBadResponse},
+	}
+	for _, c := range cases {
+		handler, calls := flakyHandler(c.fails, c.fail)
+		ts := httptest.NewServer(handler)
+		attempts := []Attempt{}
+		searchClient := &SearchClient{
+			URL: ts.URL, Timeout: 50 * time.Millisecond, Retry: retry,
+			OnAttempt: func(a Attempt) { attempts = append(attempts, a) },
+		}
+		_, err := searchClient.FindUsers(SearchRequest{Limit: 1})
+		ts.Close()
+
+		if c.expectErr == nil && err != nil || !errors.Is(err, c.expectErr) {
+			t.Errorf("[%s] expected %v, got %v", c.name, c.expectErr, err)
+		}
+		if *calls != c.calls || int32(len(attempts)) != c.calls {
+			t.Errorf("[%s] got %d calls and %d attempts, expected %d", c.name, *calls, len(attempts), c.calls)
+			continue
+		}
+		for i, a := range attempts {
+			last := i == len(attempts)-1
+			if a.Number != i+1 || a.Retry == last || (a.Err == nil) != (last && c.expectErr == nil) {
+				t.Errorf("[%s] unexpected attempt %+v", c.name, a)
+			}
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	for failures, max := range map[int]time.Duration{1: 10, 2: 20, 3: 40, 4: 50, 100: 50} {
+		max *= time.Millisecond
+		for i := 0; i < 100; i++ {
+			if d := p.delay(failures); d < max/2 || d > max {
+				t.Fatalf("delay after %d failures: got %s, expected in [%s, %s]", failures, d, max/2, max)
+			}
+		}
+	}
+	if d := (RetryPolicy{BaseDelay: time.Second}).delay(1000); d > time.Hour*2 || d <= 0 {
+		t.Errorf("unbounded delay must not overflow, got %s", d)
+	}
+}
+
+func TestRetryContextCancel(t *testing.T) {
+	handler, _ := flakyHandler(5, server.InternalServerError)
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	searchClient := &SearchClient{URL: ts.URL, Retry: RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := searchClient.FindUsersContext(ctx, SearchRequest{})
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > time.Second {
+		t.Errorf("expected fast context.DeadlineExceeded, got %v after %s", err, time.Since(start))
+	}
+	searchErr := &SearchError{}
+	if !errors.As(err, &searchErr) || !errors.Is(searchErr.Cause, ErrServer) {
+		t.Errorf("last attempt error must be kept as cause, got %+v", searchErr)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var failing int32 = 1
+	calls := new(int32)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+	breaker := &CircuitBreaker{Threshold: 3, Cooldown: 50 * time.Millisecond}
+	searchClient := &SearchClient{URL: ts.URL, Breaker: breaker, Retry: RetryPolicy{MaxAttempts: 2}}
+
+	find := func() error {
+		_, err := searchClient.FindUsers(SearchRequest{})
+		return err
+	}
+	// 2 попытки, потом ещё одна: цепь разомкнулась на третьей неудаче
+	if err := find(); !errors.Is(err, ErrServer) {
+		t.Fatalf("expected ErrServer, got %v", err)
+	}
+	if err := find(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrServer then open circuit, got %v", err)
+	}
+	if *calls != 3 {
+		t.Fatalf("got %d calls, expected 3", *calls)
+	}
+	if err := find(); !errors.Is(err, ErrCircuitOpen) || *calls != 3 {
+		t.Fatalf("expected ErrCircuitOpen without calls, got %v and %d calls", err, *calls)
+	}
+
+	// пробный запрос после Cooldown неудачен - цепь снова разомкнута, повтор не идёт
+	time.Sleep(60 * time.Millisecond)
+	if err := find(); !errors.Is(err, ErrCircuitOpen) || *calls != 4 {
+		t.Fatalf("expected failed probe, got %v and %d calls", err, *calls)
+	}
+	if err := find(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen after failed probe, got %v", err)
+	}
+
+	// удачный пробный запрос замыкает цепь
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if err := find(); err != nil {
+			t.Fatalf("[%d] expected closed circuit, got %v", i, err)
+		}
+	}
+}
+
+func TestCircuitBreakerStopsRetry(t *testing.T) {
+	handler, calls := flakyHandler(100, server.InternalServerError)
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	attempts := []Attempt{}
+	searchClient := &SearchClient{
+		URL:       ts.URL,
+		Breaker:   &CircuitBreaker{Threshold: 1, Cooldown: time.Hour},
+		Retry:     RetryPolicy{MaxAttempts: 6, BaseDelay: 100 * time.Millisecond},
+		OnAttempt: func(a Attempt) { attempts = append(attempts, a) },
+	}
+
+	start := time.Now()
+	_, err := searchClient.FindUsers(SearchRequest{})
+	elapsed := time.Since(start)
+	if !errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrServer) {
+		t.Errorf("expected bare ErrCircuitOpen, got %v", err)
+	}
+	if *calls != 1 || len(attempts) != 2 {
+		t.Fatalf("got %d calls and %d attempts, expected 1 call and 2 attempts", *calls, len(attempts))
+	}
+	if attempts[0].Delay != 0 || attempts[1].Retry || elapsed >= 50*time.Millisecond {
+		t.Errorf("expected no backoff against open circuit, got %+v after %s", attempts, elapsed)
+	}
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(server.Unauthorized))
+	defer ts.Close()
+	searchClient := &SearchClient{URL: ts.URL, Breaker: &CircuitBreaker{Threshold: 1, Cooldown: time.Hour}}
+	for i := 0; i < 3; i++ {
+		if _, err := searchClient.FindUsers(SearchRequest{}); !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("[%d] expected ErrUnauthorized, got %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package searchserver
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+)
+
+type xmlRow struct {
+	ID        int    `xml:"id"`
+	Age       int    `xml:"age"`
+	FirstName string `xml:"first_name"`
+	LastName  string `xml:"last_name"`
+	Gender    string `xml:"gender"`
+	About     string `xml:"about"`
+}
+
+// LoadDataset пользователи из xml в формате dataset.xml, в порядке файла.
+// Name - это first_name и last_name подряд, без пробела, как в исходных тестах клиента
+func LoadDataset(r io.Reader) ([]User, error) {
+	dataset := struct {
+		Rows []xmlRow `xml:"row"`
+	}{}
+	if err := xml.NewDecoder(r).Decode(&dataset); err != nil {
+		return nil, err
+	}
+	users := make([]User, 0, len(dataset.Rows))
+	for _, row := range dataset.Rows {
+		users = append(users, User{
+			Id:     row.ID,
+			Name:   row.FirstName + row.LastName,
+			Age:    row.Age,
+			About:  row.About,
+			Gender: row.Gender,
+		})
+	}
+	return users, nil
+}
+
+// Load сервер по файлу в формате dataset.xml
+func Load(path, token string) (*Server, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	users, err := LoadDataset(file)
+	if err != nil {
+		return nil, err
+	}
+	return New(users, token), nil
+}
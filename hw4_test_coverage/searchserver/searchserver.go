@@ -0,0 +1,141 @@
+// Package searchserver внешняя система, в которую ходит SearchClient: поиск пользователей
+// из dataset.xml. Датасет читается один раз и дальше ищется в памяти.
+//
+// GET /?query=&order_field=&order_by=&limit=&offset= с токеном в заголовке AccessToken.
+// Ответ - json-массив пользователей, ошибки - {"Error":"..."} со статусом 400 или 401
+package searchserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Значения order_by, те же, что у констант OrderBy* клиента: -1 по возрастанию, 0 как в датасете, 1 по убыванию
+const (
+	OrderByAsc  = -1
+	OrderByAsIs = 0
+	OrderByDesc = 1
+)
+
+// Ошибки в поле Error ответа. ErrorBadOrderField клиент узнаёт по этой строке
+const (
+	ErrorBadAccessToken = "ErrorBadAccessToken"
+	ErrorBadOrderField  = "ErrorBadOrderField"
+	ErrorBadOrderBy     = "ErrorBadOrderBy"
+	ErrorBadLimit       = "ErrorBadLimit"
+	ErrorBadOffset      = "ErrorBadOffset"
+)
+
+// User пользователь в ответе, поля как у User клиента
+type User struct {
+	Id     int
+	Name   string
+	Age    int
+	About  string
+	Gender string
+}
+
+// ErrorResponse тело ответа с ошибкой
+type ErrorResponse struct {
+	Error string
+}
+
+// Server ищет по пользователям, загруженным при создании. Безопасен для параллельных запросов:
+// после создания users только читаются
+type Server struct {
+	users []User
+	token string
+}
+
+// New сервер по users. Пустой token - AccessToken не проверяется
+func New(users []User, token string) *Server {
+	return &Server{users: users, token: token}
+}
+
+// less сравнение пользователей по полю order_field
+var less = map[string]func(a, b *User) bool{
+	"Id":   func(a, b *User) bool { return a.Id < b.Id },
+	"Age":  func(a, b *User) bool { return a.Age < b.Age },
+	"Name": func(a, b *User) bool { return a.Name < b.Name },
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" && r.Header.Get("AccessToken") != s.token {
+		writeError(w, http.StatusUnauthorized, ErrorBadAccessToken)
+		return
+	}
+
+	params := r.URL.Query()
+	field := params.Get("order_field")
+	if field == "" {
+		field = "Name"
+	}
+	cmp, ok := less[field]
+	if !ok {
+		writeError(w, http.StatusBadRequest, ErrorBadOrderField)
+		return
+	}
+	orderBy, err := intParam(params, "order_by")
+	if err != nil || orderBy < OrderByAsc || orderBy > OrderByDesc {
+		writeError(w, http.StatusBadRequest, ErrorBadOrderBy)
+		return
+	}
+	limit, err := intParam(params, "limit")
+	if err != nil || limit < 0 {
+		writeError(w, http.StatusBadRequest, ErrorBadLimit)
+		return
+	}
+	offset, err := intParam(params, "offset")
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, ErrorBadOffset)
+		return
+	}
+
+	found := s.find(params.Get("query"))
+	switch orderBy {
+	case OrderByAsc:
+		sort.SliceStable(found, func(i, j int) bool { return cmp(&found[i], &found[j]) })
+	case OrderByDesc:
+		sort.SliceStable(found, func(i, j int) bool { return cmp(&found[j], &found[i]) })
+	}
+
+	if offset > len(found) {
+		offset = len(found)
+	}
+	found = found[offset:]
+	if limit < len(found) {
+		found = found[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(found)
+}
+
+// find копия пользователей, у которых query есть в Name или About; пустой query - все
+func (s *Server) find(query string) []User {
+	found := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		if strings.Contains(u.Name, query) || strings.Contains(u.About, query) {
+			found = append(found, u)
+		}
+	}
+	return found
+}
+
+// intParam параметр-число, нет параметра - 0
+func intParam(params map[string][]string, name string) (int, error) {
+	values := params[name]
+	if len(values) == 0 || values[0] == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(values[0])
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: msg})
+}
@@ -0,0 +1,133 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testUsers = []User{
+	{Id: 3, Name: "Boyd Wolf", Age: 22, About: "likes go"},
+	{Id: 1, Name: "Hilda Mayer", Age: 21, About: "nothing"},
+	{Id: 2, Name: "Annie Osborn", Age: 35, About: "Boyd's friend"},
+	{Id: 0, Name: "Annie Ann", Age: 21, About: "go go"},
+}
+
+// search запрос к s: статус, id найденных пользователей или текст ошибки
+func search(t *testing.T, s *Server, token, query string) (int, []int, string) {
+	req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	if token != "" {
+		req.Header.Set("AccessToken", token)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		errResp := ErrorResponse{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil {
+			t.Fatalf("bad error response %q: %s", rec.Body, err)
+		}
+		return rec.Code, nil, errResp.Error
+	}
+	users := []User{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &users); err != nil {
+		t.Fatal(err)
+	}
+	ids := []int{}
+	for _, u := range users {
+		ids = append(ids, u.Id)
+	}
+	return rec.Code, ids, ""
+}
+
+func TestSearch(t *testing.T) {
+	s := New(testUsers, "")
+	cases := []struct {
+		query string
+		ids   []int
+	}{
+		{"limit=10", []int{3, 1, 2, 0}},
+		{"limit=10&query=Boyd", []int{3, 2}},
+		{"limit=10&query=go", []int{3, 0}},
+		{"limit=10&query=boyd", []int{}},
+		{"limit=10&query=" + url.QueryEscape("Annie O"), []int{2}},
+		{"limit=10&order_field=Id&order_by=-1", []int{0, 1, 2, 3}},
+		{"limit=10&order_field=Id&order_by=1", []int{3, 2, 1, 0}},
+		{"limit=10&order_field=Id&order_by=0", []int{3, 1, 2, 0}},
+		// при равенстве порядок исходный
+		{"limit=10&order_field=Age&order_by=-1", []int{1, 0, 3, 2}},
+		{"limit=10&order_field=Age&order_by=1", []int{2, 3, 1, 0}},
+		// пустой order_field - по Name
+		{"limit=10&order_by=-1", []int{0, 2, 3, 1}},
+		{"limit=10&order_field=Name&order_by=1", []int{1, 3, 2, 0}},
+		{"limit=2&offset=1&order_field=Id&order_by=-1", []int{1, 2}},
+		{"limit=2&offset=3", []int{0}},
+		{"limit=2&offset=10", []int{}},
+		{"limit=0", []int{}},
+		{"", []int{}},
+	}
+	for _, c := range cases {
+		code, ids, errMsg := search(t, s, "", c.query)
+		if code != http.StatusOK {
+			t.Errorf("%s: got %d %s", c.query, code, errMsg)
+			continue
+		}
+		if !reflect.DeepEqual(ids, c.ids) {
+			t.Errorf("%s: got ids %v, expected %v", c.query, ids, c.ids)
+		}
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	s := New(testUsers, "secret")
+	cases := []struct {
+		token, query string
+		code         int
+		err          string
+	}{
+		{"", "limit=1", http.StatusUnauthorized, ErrorBadAccessToken},
+		{"wrong", "limit=1", http.StatusUnauthorized, ErrorBadAccessToken},
+		{"secret", "limit=1&order_field=About", http.StatusBadRequest, ErrorBadOrderField},
+		{"secret", "limit=1&order_field=id", http.StatusBadRequest, ErrorBadOrderField},
+		{"secret", "limit=1&order_by=2", http.StatusBadRequest, ErrorBadOrderBy},
+		{"secret", "limit=1&order_by=x", http.StatusBadRequest, ErrorBadOrderBy},
+		{"secret", "limit=-1", http.StatusBadRequest, ErrorBadLimit},
+		{"secret", "limit=1&offset=-1", http.StatusBadRequest, ErrorBadOffset},
+		{"secret", "limit=1&offset=1.5", http.StatusBadRequest, ErrorBadOffset},
+	}
+	for _, c := range cases {
+		code, _, errMsg := search(t, s, c.token, c.query)
+		if code != c.code || errMsg != c.err {
+			t.Errorf("%q %s: got %d %q, expected %d %q", c.token, c.query, code, errMsg, c.code, c.err)
+		}
+	}
+	if code, ids, _ := search(t, s, "secret", "limit=1"); code != http.StatusOK || len(ids) != 1 {
+		t.Errorf("valid token: got %d %v", code, ids)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	s, err := Load("../dataset.xml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.users) != 35 {
+		t.Fatalf("got %d users", len(s.users))
+	}
+	first := s.users[0]
+	if first.Id != 0 || first.Name != "BoydWolf" || first.Age != 22 || first.Gender != "male" ||
+		!strings.HasPrefix(first.About, "Nulla cillum") {
+		t.Errorf("unexpected first user %+v", first)
+	}
+
+	if _, err := Load("no_such_file.xml", ""); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+	if _, err := LoadDataset(strings.NewReader("<root><row><id>x</id></row></root>")); err == nil {
+		t.Error("expected error for bad id")
+	}
+}